@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -9,8 +10,11 @@ import (
 	"time"
 
 	"SecureMessenger/server/internal/appMiddleware"
+	"SecureMessenger/server/internal/config"
 	"SecureMessenger/server/internal/db"
 	"SecureMessenger/server/internal/handlers"
+	"SecureMessenger/server/internal/services"
+	"SecureMessenger/server/internal/storage"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
@@ -29,19 +33,49 @@ func main() {
 
 	r.Post("/register", handlers.Register)
 	r.Post("/login", handlers.Login)
+	r.Post("/auth/refresh", handlers.RefreshToken)
+	r.Post("/auth/logout", handlers.Logout)
+	r.Options("/api/uploads", handlers.UploadOptions)
+	r.Options("/api/uploads/{id}", handlers.UploadOptions)
 
 	r.Group(func(r chi.Router) {
 		r.Use(appMiddleware.AuthMiddleware)
+		r.Post("/auth/logout-all", handlers.LogoutAll)
 		r.Get("/api/profile", handlers.GetProfile)
+		r.Put("/api/profile/privacy", handlers.UpdatePrivacy)
+		r.Get("/api/users/{id}/presence", handlers.GetUserPresence)
+		r.Get("/api/sessions", handlers.GetSessions)
+		r.Delete("/api/sessions/{id}", handlers.DeleteSession)
+		r.Get("/api/sync", handlers.GetSync)
+		r.Get("/api/me/storage", handlers.GetStorageUsage)
 
 		r.Get("/api/chats", handlers.GetChatsByUserId)
 		r.Get("/api/chats/{chat_id}", handlers.GetChatById)
+		r.Get("/api/chats/{chat_id}/messages/{message_id}/reads", handlers.GetMessageReads)
+		r.Get("/api/chats/{chat_id}/messages/{message_id}/edits", handlers.GetMessageEdits)
+		r.Get("/api/chats/{chat_id}/threads/{message_id}", handlers.GetThread)
+		r.Get("/api/chats/{chat_id}/pins", handlers.GetPinnedMessages)
+		r.Post("/api/chats/{chat_id}/pins", handlers.PinMessage)
+		r.Delete("/api/chats/{chat_id}/pins/{message_id}", handlers.UnpinMessage)
+		r.Post("/api/chats/{chat_id}/files", handlers.UploadFile)
+		r.Get("/api/chats/{chat_id}/media", handlers.GetChatMedia)
+		r.Get("/api/files/{id}", handlers.DownloadFile)
+		r.Post("/api/uploads", handlers.CreateUpload)
+		r.Head("/api/uploads/{id}", handlers.GetUploadOffset)
+		r.Patch("/api/uploads/{id}", handlers.PatchUpload)
+		r.Delete("/api/uploads/{id}", handlers.DeleteUpload)
 		r.Post("/api/chats/{chat_id}/participants", handlers.AddParticipant)
 		r.Delete("/api/chats/{chat_id}/participants", handlers.RemoveParticipant)
 		r.Post("/api/users/public-keys", handlers.GetPublicKeys)
 		r.Get("/api/channels/search", handlers.SearchPublicChannels)
 		r.Post("/api/channels/{channelID}/join", handlers.JoinChat)
 		r.Post("/api/channels/{id}/leave", handlers.LeaveChannel)
+
+		r.Get("/api/admin/quotas/{scope}/{id}", handlers.GetStorageQuota)
+		r.Put("/api/admin/quotas/{scope}/{id}", handlers.SetStorageQuota)
+		r.Delete("/api/admin/quotas/{scope}/{id}", handlers.DeleteStorageQuota)
+
+		r.With(handlers.AdminOnly).Handle("/debug/vars", expvar.Handler())
 	})
 
 	r.Get("/ws", handlers.WebSocketHandler)
@@ -57,6 +91,10 @@ func main() {
 
 	log.Printf("Server started on port %s\n", port)
 
+	go pruneEvents(config.GetDuration("EVENT_RETENTION", 30*24*time.Hour))
+	go expireUploads()
+	go collectStorageGarbage(config.GetDuration("STORAGE_GC_INTERVAL", time.Hour))
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %s\n", err)
@@ -76,3 +114,90 @@ func main() {
 	}
 	log.Println("Server has been successfully stopped")
 }
+
+func pruneEvents(retention time.Duration) {
+	eventService := services.NewEventService()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := eventService.PruneEvents(context.Background(), retention); err != nil {
+			log.Printf("Error pruning events: %v", err)
+		}
+	}
+}
+
+func expireUploads() {
+	uploadService := services.NewUploadService()
+	store, err := storage.NewFromConfig()
+	if err != nil {
+		log.Printf("Upload expiry disabled: %v", err)
+		return
+	}
+	staging, err := storage.NewStagingFromConfig(store)
+	if err != nil {
+		log.Printf("Upload expiry disabled: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ids, err := uploadService.DeleteExpiredUploads(context.Background())
+		if err != nil {
+			log.Printf("Error expiring uploads: %v", err)
+			continue
+		}
+		for _, id := range ids {
+			if err := staging.Remove(context.Background(), id); err != nil {
+				log.Printf("Error removing staged upload %s: %v", id, err)
+			}
+		}
+	}
+}
+
+// collectStorageGarbage expires files and then deletes the blobs of storage
+// objects that are no longer referenced by any file.
+func collectStorageGarbage(interval time.Duration) {
+	fileService := services.NewFileService()
+	store, err := storage.NewFromConfig()
+	if err != nil {
+		log.Printf("Storage GC disabled: %v", err)
+		return
+	}
+
+	retention := config.GetDuration("FILE_RETENTION", 0)
+	unattachedTTL := config.GetDuration("UNATTACHED_FILE_TTL", 24*time.Hour)
+	grace := config.GetDuration("STORAGE_GC_GRACE", time.Hour)
+	batchSize := config.GetInt("STORAGE_GC_BATCH_SIZE", 500)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		if _, err := fileService.DeleteExpiredFiles(ctx, retention, unattachedTTL); err != nil {
+			log.Printf("Error expiring files: %v", err)
+		}
+
+		for {
+			keys, err := fileService.DeleteUnreferencedObjects(ctx, grace, batchSize)
+			if err != nil {
+				log.Printf("Error collecting storage objects: %v", err)
+				break
+			}
+			for _, key := range keys {
+				if err := store.Delete(ctx, key); err != nil {
+					log.Printf("Error deleting blob %s, it is no longer tracked: %v", key, err)
+				}
+			}
+			if len(keys) > 0 {
+				log.Printf("Storage GC deleted %d blobs", len(keys))
+			}
+			if len(keys) < batchSize {
+				break
+			}
+		}
+	}
+}
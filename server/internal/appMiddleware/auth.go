@@ -7,9 +7,63 @@ import (
 	"net/http"
 	"strings"
 
+	"SecureMessenger/server/internal/services"
+
 	"github.com/golang-jwt/jwt/v4"
 )
 
+type AuthInfo struct {
+	UserID    int
+	Username  string
+	SessionID int
+}
+
+var sessionService services.SessionService
+
+func init() {
+	sessionService = services.NewSessionService()
+}
+
+func Authenticate(ctx context.Context, tokenStr string) (*AuthInfo, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return services.JWTSecret, nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims in token")
+	}
+
+	rawUserID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("missing user_id claim")
+	}
+	username, _ := claims["username"].(string)
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return nil, errors.New("missing jti claim")
+	}
+
+	userID := int(rawUserID)
+	session, err := sessionService.ValidateSession(ctx, jti, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthInfo{
+		UserID:    userID,
+		Username:  username,
+		SessionID: session.ID,
+	}, nil
+}
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Handling request: %s %s", r.Method, r.URL.Path)
@@ -28,30 +82,17 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("invalid signing method")
-			}
-			return []byte("secret-key"), nil
-		})
-
-		if err != nil || !token.Valid {
+		auth, err := Authenticate(r.Context(), tokenStr)
+		if err != nil {
 			log.Printf("Invalid token: %v", err)
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || claims["user_id"] == nil {
-			log.Println("Invalid claims in token")
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		userID := int(claims["user_id"].(float64))
-		log.Printf("Authenticated user ID: %d", userID)
+		log.Printf("Authenticated user ID: %d, session ID: %d", auth.UserID, auth.SessionID)
 
-		ctx := context.WithValue(r.Context(), "user_id", userID)
+		ctx := context.WithValue(r.Context(), "user_id", auth.UserID)
+		ctx = context.WithValue(ctx, "session_id", auth.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
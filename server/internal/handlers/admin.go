@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+)
+
+// AdminOnly lets requests through only for admins. It must run after
+// AuthMiddleware.
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	currentUserID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	isAdmin, err := userService.IsAdmin(r.Context(), currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is an admin: %v", currentUserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !isAdmin {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
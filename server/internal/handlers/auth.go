@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"SecureMessenger/server/internal/models"
+	"SecureMessenger/server/internal/pool"
+	"SecureMessenger/server/internal/services"
+)
+
+var authService services.AuthService
+var sessionService services.SessionService
+
+func init() {
+	sessionService = services.NewSessionService()
+	authService = services.NewAuthService(services.NewUserService(), sessionService)
+}
+
+// maxDeviceNameLength is the size of the sessions.device_name column.
+const maxDeviceNameLength = 100
+
+func deviceInfoFromRequest(r *http.Request, deviceName string) models.DeviceInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	deviceName = strings.ToValidUTF8(deviceName, "")
+	if runes := []rune(deviceName); len(runes) > maxDeviceNameLength {
+		deviceName = string(runes[:maxDeviceNameLength])
+	}
+
+	return models.DeviceInfo{
+		DeviceName: deviceName,
+		UserAgent:  r.UserAgent(),
+		IPAddress:  ip,
+	}
+}
+
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	tokens, revokedSessionID, err := authService.RefreshTokens(r.Context(), req.RefreshToken)
+	if revokedSessionID != 0 {
+		pool.GlobalPool.DisconnectSession(revokedSessionID)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRefreshToken) || errors.Is(err, models.ErrRefreshTokenReused) {
+			log.Printf("Refresh rejected: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Invalid refresh token",
+			})
+			return
+		}
+		log.Printf("Error refreshing tokens: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := authService.RevokeRefreshToken(r.Context(), req.RefreshToken)
+	if err != nil && !errors.Is(err, models.ErrInvalidRefreshToken) {
+		log.Printf("Error revoking refresh token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if sessionID != 0 {
+		pool.GlobalPool.DisconnectSession(sessionID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logged out",
+	})
+}
+
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		log.Println("User ID not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionIDs, err := sessionService.RevokeAllSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking sessions of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, sessionID := range sessionIDs {
+		pool.GlobalPool.DisconnectSession(sessionID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logged out from all devices",
+	})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
@@ -92,22 +93,15 @@ func GetChatById(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
 		return
 	}
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
-	}
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		limit = 20
+	messageQuery, err := parseMessageQuery(r)
+	if err != nil {
+		log.Printf("Invalid message query for chat %d: %v", chatID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	messageQuery.ViewerID = currentUserID
 
-	offset := (page - 1) * limit
-
-	messages, err := chatService.GetMessagesByChatId(ctx, chatID, offset, limit)
+	page, err := chatService.GetMessagesByChatId(ctx, chatID, messageQuery)
 	if err != nil {
 		log.Printf("Error getting messages for chat %d: %v", chatID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -131,11 +125,232 @@ func GetChatById(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"chat_id":      chatID,
-		"messages":     messages,
+		"messages":     page.Messages,
+		"next_cursor":  page.NextCursor,
+		"has_more":     page.HasMore,
 		"participants": filteredParticipants,
 	})
 }
 
+func GetMessageReads(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	chatID, messageID, ok := parseChatMessagePath(w, r)
+	if !ok {
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, chatID, currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", currentUserID, chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
+		return
+	}
+
+	readers, err := chatService.GetMessageReaders(ctx, chatID, messageID)
+	if err != nil {
+		log.Printf("Error getting readers of message %d in chat %d: %v", messageID, chatID, err)
+		if errors.Is(err, models.ErrMessageNotFound) {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"read_by":    readers,
+	})
+}
+
+func GetMessageEdits(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	chatID, messageID, ok := parseChatMessagePath(w, r)
+	if !ok {
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, chatID, currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", currentUserID, chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
+		return
+	}
+
+	edits, err := chatService.GetMessageEdits(ctx, chatID, messageID)
+	if err != nil {
+		log.Printf("Error getting edits of message %d in chat %d: %v", messageID, chatID, err)
+		if errors.Is(err, models.ErrMessageNotFound) {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"edits":      edits,
+	})
+}
+
+func GetThread(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	chatID, rootID, ok := parseChatMessagePath(w, r)
+	if !ok {
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, chatID, currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", currentUserID, chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
+		return
+	}
+
+	messageQuery, err := parseMessageQuery(r)
+	if err != nil {
+		log.Printf("Invalid message query for thread %d: %v", rootID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	messageQuery.ViewerID = currentUserID
+	messageQuery.ThreadRootID = rootID
+
+	thread, err := chatService.GetThread(ctx, chatID, rootID, currentUserID)
+	if err != nil {
+		log.Printf("Error getting thread %d in chat %d: %v", rootID, chatID, err)
+		if errors.Is(err, models.ErrMessageNotFound) {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	page, err := chatService.GetMessagesByChatId(ctx, chatID, messageQuery)
+	if err != nil {
+		log.Printf("Error getting replies of thread %d: %v", rootID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"chat_id":     chatID,
+		"thread":      thread,
+		"messages":    page.Messages,
+		"next_cursor": page.NextCursor,
+		"has_more":    page.HasMore,
+	})
+}
+
+// parseChatMessagePath extracts the chat and message IDs from
+// /api/chats/{chat_id}/{messages,threads}/{message_id}/... paths.
+func parseChatMessagePath(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/chats/"), "/")
+	if len(parts) < 3 || parts[0] == "" || parts[2] == "" {
+		log.Println("Missing chat ID or message ID in URL")
+		http.Error(w, "Missing chat ID or message ID in URL", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	chatID, err := strconv.Atoi(parts[0])
+	if err != nil || chatID <= 0 {
+		log.Printf("Invalid chat ID: %s", parts[0])
+		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	messageID, err := strconv.Atoi(parts[2])
+	if err != nil || messageID <= 0 {
+		log.Printf("Invalid message ID: %s", parts[2])
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return chatID, messageID, true
+}
+
+func parseMessageQuery(r *http.Request) (models.MessageQuery, error) {
+	params := r.URL.Query()
+
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	query := models.MessageQuery{Limit: limit}
+
+	if beforeStr := params.Get("before_seq"); beforeStr != "" {
+		beforeSeq, err := strconv.ParseInt(beforeStr, 10, 64)
+		if err != nil || beforeSeq <= 0 {
+			return query, errors.New("invalid before_seq")
+		}
+		query.BeforeSeq = &beforeSeq
+	}
+
+	if afterStr := params.Get("after_seq"); afterStr != "" {
+		afterSeq, err := strconv.ParseInt(afterStr, 10, 64)
+		if err != nil || afterSeq < 0 {
+			return query, errors.New("invalid after_seq")
+		}
+		if query.BeforeSeq != nil {
+			return query, errors.New("before_seq and after_seq are mutually exclusive")
+		}
+		query.AfterSeq = &afterSeq
+	}
+
+	if query.BeforeSeq == nil && query.AfterSeq == nil {
+		page, err := strconv.Atoi(params.Get("page"))
+		if err == nil && page > 1 {
+			query.Offset = (page - 1) * limit
+		}
+	}
+
+	return query, nil
+}
+
 func AddParticipant(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -253,19 +468,7 @@ func RemoveParticipant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	participants, err := chatService.GetParticipants(ctx, chatID)
-	if err != nil {
-		log.Printf("Error getting participants for chat %d: %v", chatID, err)
-	} else {
-		eventData := map[string]interface{}{
-			"action":       "remove_participant",
-			"chat_id":      chatID,
-			"user_id":      user.ID,
-			"username":     user.Username,
-			"participants": participants,
-		}
-		broadcastToChat(chatID, "participant_removed", eventData)
-	}
+	notifyParticipantRemoved(ctx, chatID, user, "remove_participant")
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -438,8 +641,37 @@ func LeaveChannel(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+
+	user, err := userService.GetUserById(ctx, currentUserID)
+	if err != nil {
+		log.Printf("Error getting user by ID %d: %v", currentUserID, err)
+	} else {
+		notifyParticipantRemoved(ctx, channelID, user, "leave_channel")
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Successfully left the channel",
 	})
 }
+
+// notifyParticipantRemoved sends participant_removed to the remaining
+// participants and to the removed user, who is no longer reached by chat
+// broadcasts but still needs the event in their sync log.
+func notifyParticipantRemoved(ctx context.Context, chatID int, user *models.User, action string) {
+	participants, err := chatService.GetParticipants(ctx, chatID)
+	if err != nil {
+		log.Printf("Error getting participants for chat %d: %v", chatID, err)
+		return
+	}
+
+	eventData := map[string]interface{}{
+		"action":       action,
+		"chat_id":      chatID,
+		"user_id":      user.ID,
+		"username":     user.Username,
+		"participants": participants,
+	}
+	broadcastToChat(chatID, "participant_removed", eventData)
+	pool.GlobalPool.SendToUser(user.ID, "participant_removed", eventData)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"SecureMessenger/server/internal/config"
+	"SecureMessenger/server/internal/models"
+	"SecureMessenger/server/internal/services"
+	"SecureMessenger/server/internal/storage"
+)
+
+var (
+	fileService  services.FileService
+	fileStorage  storage.Storage
+	maxFileSize  = config.GetInt64("MAX_UPLOAD_SIZE", 100<<20)
+	transferTime = config.GetDuration("FILE_TRANSFER_TIMEOUT", 30*time.Minute)
+)
+
+func init() {
+	fileService = services.NewFileService()
+
+	var err error
+	fileStorage, err = storage.NewFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+}
+
+func UploadFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/chats/"), "/")
+	chatID, err := strconv.Atoi(parts[0])
+	if err != nil || chatID <= 0 {
+		log.Printf("Invalid chat ID: %s", parts[0])
+		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, chatID, currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", currentUserID, chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
+		return
+	}
+
+	fileName := filepath.Base(r.URL.Query().Get("name"))
+	if fileName == "" || fileName == "." || fileName == "/" || len(fileName) > 255 {
+		http.Error(w, "name query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	if r.ContentLength > maxFileSize {
+		http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		contentType = "application/octet-stream"
+	}
+
+	params := r.URL.Query()
+	mediaType, thumbnailID, ok := parseMediaInfo(w, r, currentUserID, chatID, contentType, params.Get("media_type"), params.Get("thumbnail_file_id"))
+	if !ok {
+		return
+	}
+
+	quotas, err := storageQuotas(r.Context(), currentUserID, chatID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := checkStorageQuota(r, quotas, max(r.ContentLength, 0)); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	// Large uploads outlive the server-wide read timeout.
+	extendDeadlines(w)
+
+	file := &models.File{
+		ChatID:          chatID,
+		UploaderID:      currentUserID,
+		FileName:        fileName,
+		ContentType:     contentType,
+		MediaType:       mediaType,
+		StorageKey:      newStorageKey(chatID),
+		ThumbnailFileID: thumbnailID,
+	}
+
+	hash := sha256.New()
+	body := io.TeeReader(http.MaxBytesReader(w, r.Body, maxFileSize), hash)
+	file.Size, err = fileStorage.Put(ctx, file.StorageKey, body, r.ContentLength, contentType)
+	if err != nil {
+		fileStorage.Delete(ctx, file.StorageKey)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		log.Printf("Error storing upload of user %d: %v", currentUserID, err)
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+
+	// Content-Length is optional, so CreateFile checks the quotas again with
+	// the number of bytes that were actually stored.
+	storedKey := file.StorageKey
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if err := fileService.CreateFile(ctx, file, quotas); err != nil {
+		fileStorage.Delete(ctx, storedKey)
+		writeQuotaError(w, err)
+		return
+	}
+	dropDuplicateBlob(ctx, storedKey, file)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(file)
+}
+
+func DownloadFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/files/")
+	fileID, err := strconv.Atoi(idStr)
+	if err != nil || fileID <= 0 {
+		log.Printf("Invalid file ID: %s", idStr)
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	file, err := fileService.GetFileById(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, models.ErrFileNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, file.ChatID, currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", currentUserID, file.ChatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		// Do not reveal that the file exists.
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	// Blobs are encrypted by the client and always served as opaque bytes,
+	// so a browser never renders one under the origin of this server. The
+	// declared content type is part of the file metadata.
+	const blobContentType = "application/octet-stream"
+
+	// Members get a short-lived direct link instead of having the blob
+	// proxied through the server.
+	if presigner, ok := fileStorage.(storage.Presigner); ok {
+		url, err := presigner.PresignGet(file.StorageKey, file.FileName, blobContentType)
+		if err != nil {
+			log.Printf("Error presigning file %d: %v", file.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+
+	blob, err := fileStorage.Open(ctx, file.StorageKey)
+	if err != nil {
+		log.Printf("Error opening file %d: %v", file.ID, err)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	extendDeadlines(w)
+
+	w.Header().Set("Content-Type", blobContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.FileName}))
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	if seeker, ok := blob.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", file.UploadedAt, seeker)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("Error streaming file %d: %v", file.ID, err)
+	}
+}
+
+func extendDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(transferTime)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		log.Printf("Could not extend read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		log.Printf("Could not extend write deadline: %v", err)
+	}
+}
+
+// dropDuplicateBlob deletes the freshly stored blob when the file was
+// deduplicated against an existing storage object.
+func dropDuplicateBlob(ctx context.Context, storedKey string, file *models.File) {
+	if file.StorageKey == storedKey {
+		return
+	}
+	if err := fileStorage.Delete(ctx, storedKey); err != nil {
+		log.Printf("Error deleting duplicate blob %s: %v", storedKey, err)
+	}
+}
+
+func newStorageKey(chatID int) string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("Error generating storage key: %v", err)
+	}
+	return fmt.Sprintf("chats/%d/%s", chatID, hex.EncodeToString(buf))
+}
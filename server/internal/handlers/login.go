@@ -6,16 +6,13 @@ import (
 	"log"
 	"net/http"
 	"time"
-
-	"github.com/golang-jwt/jwt/v4"
 )
 
-var jwtSecret = []byte("secret-key")
-
 func Login(w http.ResponseWriter, r *http.Request) {
 	var loginData struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"`
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&loginData)
@@ -104,15 +101,9 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error resetting failed login attempts for user %d: %v", user.ID, err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	tokenString, err := token.SignedString(jwtSecret)
+	tokens, err := authService.IssueTokens(ctx, user, deviceInfoFromRequest(r, loginData.DeviceName))
 	if err != nil {
-		log.Printf("Error creating token for user %d: %v", user.ID, err)
+		log.Printf("Error creating tokens for user %d: %v", user.ID, err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -122,5 +113,5 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
+	json.NewEncoder(w).Encode(tokens)
 }
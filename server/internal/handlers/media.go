@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"SecureMessenger/server/internal/models"
+)
+
+func GetChatMedia(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/chats/"), "/")
+	chatID, err := strconv.Atoi(parts[0])
+	if err != nil || chatID <= 0 {
+		log.Printf("Invalid chat ID: %s", parts[0])
+		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, chatID, currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", currentUserID, chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
+		return
+	}
+
+	params := r.URL.Query()
+
+	mediaType := params.Get("type")
+	if mediaType != "" && !models.IsValidMediaType(mediaType) {
+		http.Error(w, "type must be image, video, document or audio", http.StatusBadRequest)
+		return
+	}
+
+	cursor := 0
+	if cursorStr := params.Get("cursor"); cursorStr != "" {
+		cursor, err = strconv.Atoi(cursorStr)
+		if err != nil || cursor <= 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	page, err := fileService.GetChatMedia(ctx, chatID, currentUserID, mediaType, cursor, limit)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"chat_id":     chatID,
+		"type":        mediaType,
+		"items":       page.Items,
+		"next_cursor": page.NextCursor,
+		"has_more":    page.HasMore,
+	})
+}
+
+// parseMediaInfo validates the media type and thumbnail a client supplies for
+// a new file. Without an explicit media type it is derived from the content
+// type. The thumbnail has to be an unattached file the same user uploaded to
+// the same chat.
+func parseMediaInfo(w http.ResponseWriter, r *http.Request, userID, chatID int, contentType, mediaType, thumbnail string) (string, *int, bool) {
+	if mediaType == "" {
+		mediaType = models.MediaTypeForContentType(contentType)
+	}
+	if !models.IsValidMediaType(mediaType) {
+		http.Error(w, "media_type must be image, video, document or audio", http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	if thumbnail == "" {
+		return mediaType, nil, true
+	}
+
+	thumbnailID, err := strconv.Atoi(thumbnail)
+	if err != nil || thumbnailID <= 0 {
+		http.Error(w, "Invalid thumbnail_file_id", http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	thumb, err := fileService.GetFileById(r.Context(), thumbnailID)
+	if err != nil && !errors.Is(err, models.ErrFileNotFound) {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", nil, false
+	}
+	if err != nil || thumb.ChatID != chatID || thumb.UploaderID != userID || thumb.MessageID != nil {
+		http.Error(w, "Thumbnail file not found", http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	return mediaType, &thumbnailID, true
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"SecureMessenger/server/internal/config"
+	"SecureMessenger/server/internal/models"
+	"SecureMessenger/server/internal/pool"
+)
+
+var maxPinnedMessages = config.GetInt("MAX_PINNED_MESSAGES", 50)
+
+func GetPinnedMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	chatID, _, ok := parsePinPath(w, r, false)
+	if !ok {
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, chatID, currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", currentUserID, chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
+		return
+	}
+
+	pins, err := chatService.GetPinnedMessages(ctx, chatID)
+	if err != nil {
+		log.Printf("Error getting pinned messages of chat %d: %v", chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"chat_id": chatID,
+		"pins":    pins,
+		"limit":   maxPinnedMessages,
+	})
+}
+
+func PinMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	chatID, _, ok := parsePinPath(w, r, false)
+	if !ok {
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		MessageID int `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 {
+		http.Error(w, "message_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if !requireChatCreator(w, r, chatID, currentUserID) {
+		return
+	}
+
+	pin, created, err := chatService.PinMessage(ctx, chatID, req.MessageID, currentUserID, maxPinnedMessages)
+	if err != nil {
+		log.Printf("Error pinning message %d in chat %d: %v", req.MessageID, chatID, err)
+		switch {
+		case errors.Is(err, models.ErrMessageNotFound):
+			http.Error(w, "Message not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrPinLimitReached):
+			http.Error(w, "Pinned messages limit reached", http.StatusConflict)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if created {
+		pool.GlobalPool.BroadcastEvent(chatID, "message_pinned", pin)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(pin)
+}
+
+func UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	chatID, messageID, ok := parsePinPath(w, r, true)
+	if !ok {
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !requireChatCreator(w, r, chatID, currentUserID) {
+		return
+	}
+
+	removed, err := chatService.UnpinMessage(ctx, chatID, messageID)
+	if err != nil {
+		log.Printf("Error unpinning message %d in chat %d: %v", messageID, chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "Message is not pinned", http.StatusNotFound)
+		return
+	}
+
+	pool.GlobalPool.BroadcastEvent(chatID, "message_unpinned", map[string]interface{}{
+		"chat_id":     chatID,
+		"message_id":  messageID,
+		"unpinned_by": currentUserID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireChatCreator allows only the chat creator through until chats get a
+// proper role system.
+func requireChatCreator(w http.ResponseWriter, r *http.Request, chatID, userID int) bool {
+	isCreator, err := chatService.IsChatCreator(r.Context(), chatID, userID)
+	if err != nil {
+		log.Printf("Error checking creator of chat %d: %v", chatID, err)
+		if errors.Is(err, models.ErrChatNotFound) {
+			http.Error(w, "Chat not found", http.StatusNotFound)
+			return false
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !isCreator {
+		http.Error(w, "Only chat admins can manage pinned messages", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func parsePinPath(w http.ResponseWriter, r *http.Request, withMessageID bool) (int, int, bool) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/chats/"), "/")
+
+	chatID, err := strconv.Atoi(parts[0])
+	if err != nil || chatID <= 0 {
+		log.Printf("Invalid chat ID: %s", parts[0])
+		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	if !withMessageID {
+		return chatID, 0, true
+	}
+
+	if len(parts) < 3 {
+		http.Error(w, "Missing message ID in URL", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	messageID, err := strconv.Atoi(parts[2])
+	if err != nil || messageID <= 0 {
+		log.Printf("Invalid message ID: %s", parts[2])
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return chatID, messageID, true
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"SecureMessenger/server/internal/models"
+	"SecureMessenger/server/internal/pool"
+	"SecureMessenger/server/internal/services"
+)
+
+var presenceService services.PresenceService
+
+func init() {
+	presenceService = services.NewPresenceService()
+}
+
+func GetUserPresence(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	viewerID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/")
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil || userID <= 0 {
+		log.Printf("Invalid user ID: %s", parts[0])
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	presence, err := presenceService.GetPresence(ctx, viewerID, userID)
+	if err != nil {
+		log.Printf("Error getting presence of user %d: %v", userID, err)
+		if errors.Is(err, models.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	presence.Online = presence.Visible && pool.GlobalPool.IsOnline(userID)
+	if presence.Online {
+		presence.LastSeenAt = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presence)
+}
+
+func UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		LastSeenVisibility string `json:"last_seen_visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !models.IsValidLastSeenVisibility(req.LastSeenVisibility) {
+		http.Error(w, "last_seen_visibility must be one of everyone, contacts, nobody", http.StatusBadRequest)
+		return
+	}
+
+	if err := presenceService.SetLastSeenVisibility(ctx, userID, req.LastSeenVisibility); err != nil {
+		log.Printf("Error updating privacy settings of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"last_seen_visibility": req.LastSeenVisibility,
+	})
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"SecureMessenger/server/internal/config"
+	"SecureMessenger/server/internal/models"
+	"SecureMessenger/server/internal/services"
+)
+
+var (
+	quotaService services.QuotaService
+
+	// A negative limit disables it.
+	defaultQuotas = map[string]models.StorageQuota{
+		models.QuotaScopeUser: {
+			MaxBytes: config.GetInt64("USER_STORAGE_QUOTA", 10<<30),
+			MaxFiles: config.GetInt("USER_FILE_QUOTA", 10000),
+		},
+		models.QuotaScopeChat: {
+			MaxBytes: config.GetInt64("CHAT_STORAGE_QUOTA", 50<<30),
+			MaxFiles: config.GetInt("CHAT_FILE_QUOTA", 100000),
+		},
+	}
+)
+
+func init() {
+	quotaService = services.NewQuotaService()
+}
+
+// GetStorageUsage reports what the current user stores, overall and per chat.
+func GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := quotaService.GetUsage(ctx, models.QuotaScopeUser, currentUserID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	quota, err := effectiveQuota(ctx, models.QuotaScopeUser, currentUserID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	chats, err := quotaService.GetUserUsageByChat(ctx, currentUserID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"usage": usage,
+		"quota": quota,
+		"chats": chats,
+	})
+}
+
+func GetStorageQuota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	scope, targetID, ok := parseQuotaPath(w, r)
+	if !ok || !requireAdmin(w, r) {
+		return
+	}
+
+	override, err := quotaService.GetQuotaOverride(ctx, scope, targetID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	usage, err := quotaService.GetUsage(ctx, scope, targetID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scope":    scope,
+		"id":       targetID,
+		"usage":    usage,
+		"quota":    defaultQuotas[scope].WithOverride(override),
+		"default":  defaultQuotas[scope],
+		"override": override,
+	})
+}
+
+func SetStorageQuota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	scope, targetID, ok := parseQuotaPath(w, r)
+	if !ok || !requireAdmin(w, r) {
+		return
+	}
+
+	var override models.QuotaOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// -1 lifts a limit for this user or chat.
+	if (override.MaxBytes != nil && *override.MaxBytes < -1) || (override.MaxFiles != nil && *override.MaxFiles < -1) {
+		http.Error(w, "Limits must be -1 for unlimited or at least 0", http.StatusBadRequest)
+		return
+	}
+
+	adminID := ctx.Value("user_id").(int)
+	override.UpdatedBy = &adminID
+
+	if err := quotaService.SetQuotaOverride(ctx, scope, targetID, &override); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %d overrode the storage quota of %s %d", adminID, scope, targetID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scope":    scope,
+		"id":       targetID,
+		"quota":    defaultQuotas[scope].WithOverride(&override),
+		"override": override,
+	})
+}
+
+func DeleteStorageQuota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	scope, targetID, ok := parseQuotaPath(w, r)
+	if !ok || !requireAdmin(w, r) {
+		return
+	}
+
+	if err := quotaService.DeleteQuotaOverride(ctx, scope, targetID); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storageQuotas returns the effective quotas of the uploader and the chat
+// that a new file counts against, the user first.
+func storageQuotas(ctx context.Context, userID, chatID int) ([]models.QuotaCheck, error) {
+	quotas := []models.QuotaCheck{
+		{Scope: models.QuotaScopeUser, TargetID: userID},
+		{Scope: models.QuotaScopeChat, TargetID: chatID},
+	}
+
+	for i := range quotas {
+		quota, err := effectiveQuota(ctx, quotas[i].Scope, quotas[i].TargetID)
+		if err != nil {
+			return nil, err
+		}
+		quotas[i].Quota = quota
+	}
+	return quotas, nil
+}
+
+// checkStorageQuota rejects a file of the given size before its bytes are
+// received. It does not reserve anything; the services check the quotas again
+// when the file or upload is stored.
+func checkStorageQuota(r *http.Request, quotas []models.QuotaCheck, size int64) error {
+	for _, check := range quotas {
+		usage, err := quotaService.GetUsage(r.Context(), check.Scope, check.TargetID)
+		if err != nil {
+			return err
+		}
+
+		if err := check.Quota.Check(check.Scope, usage, size, 1); err != nil {
+			log.Printf("Upload of %d bytes to %s %d rejected: %v", size, check.Scope, check.TargetID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func effectiveQuota(ctx context.Context, scope string, targetID int) (models.StorageQuota, error) {
+	override, err := quotaService.GetQuotaOverride(ctx, scope, targetID)
+	if err != nil {
+		return models.StorageQuota{}, err
+	}
+	return defaultQuotas[scope].WithOverride(override), nil
+}
+
+func writeQuotaError(w http.ResponseWriter, err error) {
+	var quotaErr *models.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    ErrCodeQuotaExceeded,
+		"message": "Storage quota exceeded",
+		"scope":   quotaErr.Scope,
+		"limit":   quotaErr.Limit,
+		"quota":   quotaErr.Quota,
+		"usage":   quotaErr.Usage,
+	})
+}
+
+// parseQuotaPath parses /api/admin/quotas/{users|chats}/{id}.
+func parseQuotaPath(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/admin/quotas/"), "/")
+	if len(parts) < 2 {
+		http.Error(w, "Invalid quota path", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	scope := strings.TrimSuffix(parts[0], "s")
+	if _, ok := defaultQuotas[scope]; !ok {
+		http.Error(w, "Quota scope must be users or chats", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	targetID, err := strconv.Atoi(parts[1])
+	if err != nil || targetID <= 0 {
+		log.Printf("Invalid %s ID: %s", scope, parts[1])
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	return scope, targetID, true
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"SecureMessenger/server/internal/models"
+	"SecureMessenger/server/internal/pool"
+)
+
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		log.Println("User ID not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	currentSessionID, _ := ctx.Value("session_id").(int)
+
+	sessions, err := sessionService.GetSessionsByUserId(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting sessions for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func DeleteSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		log.Println("User ID not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := r.URL.Path
+	parts := strings.Split(strings.TrimPrefix(path, "/api/sessions/"), "/")
+	if len(parts) == 0 || parts[0] == "" {
+		log.Println("Missing session ID in URL")
+		http.Error(w, "Missing session ID in URL", http.StatusBadRequest)
+		return
+	}
+
+	sessionIDStr := parts[0]
+	sessionID, err := strconv.Atoi(sessionIDStr)
+	if err != nil || sessionID <= 0 {
+		log.Printf("Invalid session ID: %s", sessionIDStr)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	err = sessionService.RevokeSession(ctx, userID, sessionID)
+	if err != nil {
+		if errors.Is(err, models.ErrSessionNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error revoking session %d of user %d: %v", sessionID, userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pool.GlobalPool.DisconnectSession(sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Session revoked",
+	})
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"SecureMessenger/server/internal/models"
+	"SecureMessenger/server/internal/services"
+)
+
+const (
+	syncDefaultLimit = 100
+	syncMaxLimit     = 500
+	resumeBatchSize  = 100
+)
+
+var eventService services.EventService
+
+func init() {
+	eventService = services.NewEventService()
+}
+
+func GetSync(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		log.Println("User ID not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var since int64
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		parsed, err := strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = syncDefaultLimit
+	}
+	if limit > syncMaxLimit {
+		limit = syncMaxLimit
+	}
+
+	events, err := eventService.GetEventsSince(ctx, userID, since, limit+1)
+	var expired *models.CursorExpiredError
+	if errors.As(err, &expired) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"events":          []models.Event{},
+			"next_cursor":     expired.Cursor,
+			"has_more":        false,
+			"resync_required": true,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting events for user %d since %d: %v", userID, since, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	hasMore := len(events) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+
+	nextCursor := since
+	if len(events) > 0 {
+		nextCursor = events[len(events)-1].Cursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events":          events,
+		"next_cursor":     nextCursor,
+		"has_more":        hasMore,
+		"resync_required": false,
+	})
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"SecureMessenger/server/internal/config"
+	"SecureMessenger/server/internal/models"
+	"SecureMessenger/server/internal/services"
+	"SecureMessenger/server/internal/storage"
+)
+
+// Resumable uploads follow the tus 1.0.0 protocol with the creation,
+// expiration and termination extensions. See https://tus.io/protocols/resumable-upload.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+)
+
+var (
+	uploadService services.UploadService
+	uploadStaging storage.Staging
+	uploadExpiry  = config.GetDuration("UPLOAD_EXPIRY", 24*time.Hour)
+)
+
+func init() {
+	uploadService = services.NewUploadService()
+
+	var err error
+	uploadStaging, err = storage.NewStagingFromConfig(fileStorage)
+	if err != nil {
+		log.Fatalf("Failed to initialize upload staging: %v", err)
+	}
+}
+
+func UploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxFileSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func CreateUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Upload-Length header is required", http.StatusBadRequest)
+		return
+	}
+	if length > maxFileSize {
+		http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata header", http.StatusBadRequest)
+		return
+	}
+
+	chatID, err := strconv.Atoi(metadata["chat_id"])
+	if err != nil || chatID <= 0 {
+		http.Error(w, "chat_id metadata is required", http.StatusBadRequest)
+		return
+	}
+
+	fileName := filepath.Base(metadata["filename"])
+	if fileName == "" || fileName == "." || fileName == "/" || len(fileName) > 255 {
+		http.Error(w, "filename metadata is required", http.StatusBadRequest)
+		return
+	}
+
+	contentType := metadata["filetype"]
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		contentType = "application/octet-stream"
+	}
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, chatID, currentUserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", currentUserID, chatID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
+		return
+	}
+
+	mediaType, thumbnailID, ok := parseMediaInfo(w, r, currentUserID, chatID, contentType, metadata["media_type"], metadata["thumbnail_file_id"])
+	if !ok {
+		return
+	}
+
+	quotas, err := storageQuotas(r.Context(), currentUserID, chatID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := checkStorageQuota(r, quotas, length); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	upload := &models.Upload{
+		UserID:      currentUserID,
+		ChatID:      chatID,
+		FileName:    fileName,
+		ContentType: contentType,
+		MediaType:   mediaType,
+		ThumbnailID: thumbnailID,
+		Length:      length,
+	}
+	if err := uploadService.CreateUpload(ctx, upload, uploadExpiry, quotas); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Location", "/api/uploads/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func GetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	upload, ok := loadUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+func PatchUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Upload-Offset header is required", http.StatusBadRequest)
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The request deadline ends before the upload lease does, so a stalled
+	// client cannot keep writing after another request took over.
+	extendDeadlines(w)
+
+	var chunkErr error
+	upload, err := uploadService.AppendUpload(ctx, uploadIDFromPath(r), currentUserID, uploadExpiry, transferTime+time.Minute, func(upload *models.Upload) (int64, error) {
+		if offset != upload.Offset {
+			return 0, models.ErrUploadConflict
+		}
+		if upload.Complete() {
+			return 0, nil
+		}
+
+		var written int64
+		written, chunkErr = uploadStaging.Append(ctx, upload.ID, offset, io.LimitReader(r.Body, upload.Length-offset))
+		return written, chunkErr
+	})
+	if err != nil {
+		if chunkErr != nil && err == chunkErr {
+			log.Printf("Error receiving chunk of upload %s at offset %d: %v", uploadIDFromPath(r), offset, err)
+			http.Error(w, "Failed to store upload chunk", http.StatusInternalServerError)
+			return
+		}
+		writeUploadError(w, err)
+		return
+	}
+
+	// A completed upload whose file could not be created before is retried
+	// here, so clients only need to repeat the last PATCH.
+	if upload.Complete() && upload.FileID == nil {
+		if err := finishUpload(r, upload); err != nil {
+			if errors.Is(err, models.ErrUserNotParticipant) {
+				http.Error(w, "User is not a participant of this chat", http.StatusForbidden)
+				return
+			}
+			log.Printf("Error finishing upload %s: %v", upload.ID, err)
+			http.Error(w, "Failed to store file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	currentUserID, ok := ctx.Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uploadID := uploadIDFromPath(r)
+	if err := uploadService.DeleteUpload(ctx, uploadID, currentUserID); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	if err := uploadStaging.Remove(ctx, uploadID); err != nil {
+		log.Printf("Error removing staged upload %s: %v", uploadID, err)
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishUpload moves the staged bytes to file storage and links them to a
+// new files row. The uploader may have left the chat since the upload was
+// created, so membership is checked again.
+func finishUpload(r *http.Request, upload *models.Upload) error {
+	ctx := r.Context()
+
+	isParticipant, err := chatService.IsUserParticipant(ctx, upload.ChatID, upload.UserID)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", upload.UserID, upload.ChatID, err)
+		return err
+	}
+	if !isParticipant {
+		log.Printf("User %d left chat %d before upload %s completed", upload.UserID, upload.ChatID, upload.ID)
+		return models.ErrUserNotParticipant
+	}
+
+	staged, err := uploadStaging.Open(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+	defer staged.Close()
+
+	hash := sha256.New()
+	storageKey := newStorageKey(upload.ChatID)
+	body := io.TeeReader(io.LimitReader(staged, upload.Length), hash)
+	if _, err := fileStorage.Put(ctx, storageKey, body, upload.Length, upload.ContentType); err != nil {
+		fileStorage.Delete(ctx, storageKey)
+		return err
+	}
+
+	file, err := uploadService.CompleteUpload(ctx, upload, storageKey, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		fileStorage.Delete(ctx, storageKey)
+		return err
+	}
+	dropDuplicateBlob(ctx, storageKey, file)
+
+	if err := uploadStaging.Remove(ctx, upload.ID); err != nil {
+		log.Printf("Error removing staged upload %s: %v", upload.ID, err)
+	}
+	return nil
+}
+
+func loadUpload(w http.ResponseWriter, r *http.Request) (*models.Upload, bool) {
+	currentUserID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	upload, err := uploadService.GetUpload(r.Context(), uploadIDFromPath(r), currentUserID)
+	if err != nil {
+		writeUploadError(w, err)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+func uploadIDFromPath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/api/uploads/")
+}
+
+func writeUploadError(w http.ResponseWriter, err error) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	switch {
+	case errors.Is(err, models.ErrUploadNotFound):
+		http.Error(w, "Upload not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrUploadConflict):
+		http.Error(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+	case errors.Is(err, models.ErrUploadLocked):
+		http.Error(w, "Upload is already in progress", http.StatusConflict)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeUploadHeaders(w http.ResponseWriter, upload *models.Upload) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.FileID != nil {
+		w.Header().Set("X-File-Id", strconv.Itoa(*upload.FileID))
+	}
+}
+
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes the comma separated "key base64(value)" pairs
+// of the Upload-Metadata header.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if header == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, errors.New("malformed metadata pair")
+		}
+	}
+	return metadata, nil
+}
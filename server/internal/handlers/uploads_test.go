@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty header", "", map[string]string{}, false},
+		{"pairs", "filename aGVsbG8udHh0,chat_id NDI=", map[string]string{"filename": "hello.txt", "chat_id": "42"}, false},
+		{"key without value", "is_confidential", map[string]string{"is_confidential": ""}, false},
+		{"bad base64", "filename not-base64!", nil, true},
+		{"three fields", "filename aGVsbG8udHh0 extra", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadMetadata(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUploadMetadata(%q) error = %v, want error %v", tt.header, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseUploadMetadata(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
@@ -8,11 +8,12 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/gorilla/websocket"
 
+	"SecureMessenger/server/internal/appMiddleware"
 	"SecureMessenger/server/internal/models"
 	"SecureMessenger/server/internal/pool"
+	"SecureMessenger/server/internal/utils"
 )
 
 var upgrader = websocket.Upgrader{
@@ -33,26 +34,15 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte("secret-key"), nil
-	})
-
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || claims["user_id"] == nil || claims["username"] == nil {
+	auth, err := appMiddleware.Authenticate(r.Context(), tokenStr)
+	if err != nil {
+		log.Printf("Invalid token: %v", err)
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	userID := int(claims["user_id"].(float64))
-	username := claims["username"].(string)
+	userID := auth.UserID
+	username := auth.Username
 
 	log.Printf("Authenticated user ID: %d, Username: %s", userID, username)
 
@@ -66,270 +56,876 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("User %d connected to WebSocket", userID)
 
 	clientPool := pool.GlobalPool
-	clientPool.AddClient(userID, conn)
+	client := clientPool.AddClient(userID, auth.SessionID, conn)
+	defer clientPool.RemoveClient(client)
 
-	for {
-		var msg struct {
-			Event   string `json:"event"`
-			ChatID  int    `json:"chat_id"`
-			Content string `json:"content"`
-		}
+	wsConn := &wsConnection{
+		ctx:      r.Context(),
+		userID:   userID,
+		username: username,
+		client:   client,
 
-		err := conn.ReadJSON(&msg)
+		typingSentAt: make(map[int]time.Time),
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Error reading message from user %d: %v", userID, err)
 			break
 		}
 
-		log.Printf("User %d sent event '%s' to chat %d: %s", userID, msg.Event, msg.ChatID, msg.Content)
+		var msg wsFrame
+		if err := json.Unmarshal(data, &msg); err != nil {
+			wsConn.sendError(msg, newWSError(ErrCodeInvalidFrame, "Frame is not valid JSON"))
+			continue
+		}
+
+		log.Printf("User %d sent event '%s' (request %s) to chat %d: %s", userID, msg.Event, msg.RequestID, msg.ChatID, msg.Content)
+
+		var result map[string]interface{}
+		var wsErr *wsError
 
 		switch msg.Event {
 		case "send_message":
-			messageID, sentAt, err := chatService.SaveMessage(r.Context(), msg.ChatID, userID, username, msg.Content)
-			if err != nil {
-				log.Printf("Error saving message: %v", err)
-				continue
-			}
+			result, wsErr = wsConn.handleSendMessage(msg)
+		case "create_chat":
+			result, wsErr = wsConn.handleCreateChat(msg)
+		case "message_read":
+			result, wsErr = wsConn.handleMessageRead(msg)
+		case "message_delivered":
+			result, wsErr = wsConn.handleMessageDelivered(msg)
+		case "thread_read":
+			result, wsErr = wsConn.handleThreadRead(msg)
+		case "resume":
+			result, wsErr = wsConn.handleResume(msg)
+		case "forward_message":
+			result, wsErr = wsConn.handleForwardMessage(msg)
+		case "edit_message":
+			result, wsErr = wsConn.handleEditMessage(msg)
+		case "delete_message":
+			result, wsErr = wsConn.handleDeleteMessage(msg)
+		case "add_reaction", "remove_reaction":
+			result, wsErr = wsConn.handleReaction(msg)
+		case "typing_start", "typing_stop":
+			result, wsErr = wsConn.handleTyping(msg)
+		default:
+			wsErr = newWSError(ErrCodeUnknownEvent, "Unknown event: "+msg.Event)
+		}
 
-			eventData := map[string]interface{}{
-				"message_id": strconv.Itoa(messageID),
-				"sender_id":  strconv.Itoa(userID),
-				"username":   username,
-				"content":    msg.Content,
-				"chat_id":    msg.ChatID,
-				"sent_at":    sentAt.Format(time.RFC3339),
-			}
+		if wsErr != nil {
+			wsConn.sendError(msg, wsErr)
+			continue
+		}
+		wsConn.sendAck(msg, result)
+	}
 
-			clientPool.BroadcastEvent(msg.ChatID, "new_message", eventData)
+	wsConn.stopTyping()
+}
 
-			log.Printf("Message sent to chat %d by user %d (%s) at %s, Message ID: %d", msg.ChatID, userID, username, sentAt, messageID)
+func (c *wsConnection) handleSendMessage(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.ChatID <= 0 || (msg.Content == "" && len(msg.FileIDs) == 0) {
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id and content or file_ids are required")
+	}
+	if len(msg.FileIDs) > maxMessageFiles {
+		return nil, newWSError(ErrCodeInvalidRequest, "Too many files in one message")
+	}
 
-		case "create_chat":
-			log.Printf("WEBSOCKET create_chat")
-			var createChatReq struct {
-				RecipientEmail *string               `json:"recipient_email"`
-				Type           string                `json:"type"`
-				Name           *string               `json:"name"`
-				Emails         []string              `json:"emails"`
-				EncryptedKeys  []models.EncryptedKey `json:"encrypted_keys"`
-				RawAESKey      *string               `json:"raw_aes_key"`
-			}
-			err := json.Unmarshal([]byte(msg.Content), &createChatReq)
-			if err != nil || createChatReq.Type == "" {
-				log.Printf("Invalid create_chat request from user %d: %v", userID, err)
-				continue
-			}
+	isParticipant, err := chatService.IsUserInChat(c.ctx, msg.ChatID, c.userID)
+	if err != nil {
+		log.Printf("Error checking user %d in chat %d: %v", c.userID, msg.ChatID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to check chat membership")
+	}
+	if !isParticipant {
+		return nil, newWSError(ErrCodeNotParticipant, "User is not a participant of this chat")
+	}
+
+	message := models.Message{
+		ChatID:   msg.ChatID,
+		SenderID: c.userID,
+		Username: c.username,
+		Content:  msg.Content,
+	}
+	if msg.ClientMessageID != "" {
+		if !utils.IsValidUUID(msg.ClientMessageID) {
+			return nil, newWSError(ErrCodeInvalidRequest, "client_message_id must be a UUID")
+		}
+		message.ClientMessageID = &msg.ClientMessageID
+	}
+	if msg.ReplyToID > 0 {
+		message.ReplyTo = &models.MessageRef{ID: msg.ReplyToID}
+	}
+	if msg.ThreadRootID > 0 {
+		message.ThreadRootID = &msg.ThreadRootID
+	}
+	seenFiles := make(map[int]bool, len(msg.FileIDs))
+	for _, fileID := range msg.FileIDs {
+		if fileID <= 0 || seenFiles[fileID] {
+			return nil, newWSError(ErrCodeInvalidRequest, "file_ids must be unique positive IDs")
+		}
+		seenFiles[fileID] = true
+		message.Files = append(message.Files, models.File{ID: fileID})
+	}
+
+	if message.ReplyTo != nil || message.ThreadRootID != nil {
+		chatType, err := chatService.GetChatType(c.ctx, msg.ChatID)
+		if err != nil {
+			log.Printf("Error getting type of chat %d: %v", msg.ChatID, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to load chat")
+		}
+		if !models.PolicyForChatType(chatType).AllowReplies {
+			return nil, newWSError(ErrCodeForbidden, "Replies are not allowed in this chat")
+		}
+	}
+
+	saved, created, err := chatService.SaveMessage(c.ctx, message)
+	if err != nil {
+		if errors.Is(err, models.ErrMessageNotFound) {
+			return nil, newWSError(ErrCodeMessageNotFound, "Replied-to message or thread root not found in this chat")
+		}
+		if errors.Is(err, models.ErrFileNotFound) {
+			return nil, newWSError(ErrCodeFileNotFound, "File not found or already attached")
+		}
+		log.Printf("Error saving message: %v", err)
+		return nil, newWSError(ErrCodeInternal, "Failed to save message")
+	}
+	delete(c.typingSentAt, msg.ChatID)
+
+	result := map[string]interface{}{
+		"message_id":        saved.ID,
+		"chat_id":           saved.ChatID,
+		"seq":               saved.Seq,
+		"sent_at":           saved.SentAt.Format(time.RFC3339),
+		"client_message_id": msg.ClientMessageID,
+	}
+
+	if !created {
+		if saved.ChatID != msg.ChatID {
+			return nil, newWSError(ErrCodeInvalidRequest, "client_message_id was already used in another chat")
+		}
+		log.Printf("Duplicate send_message from user %d, returning existing message %d", c.userID, saved.ID)
+		result["duplicate"] = true
+		return result, nil
+	}
+
+	eventData := newMessageEventData(saved)
+
+	if saved.ThreadRootID != nil {
+		eventData["thread_root_id"] = *saved.ThreadRootID
+		pool.GlobalPool.BroadcastEvent(msg.ChatID, "thread_reply", eventData)
+	} else {
+		pool.GlobalPool.BroadcastEvent(msg.ChatID, "new_message", eventData)
+	}
+
+	log.Printf("Message sent to chat %d by user %d (%s) at %s, Message ID: %d", msg.ChatID, c.userID, c.username, saved.SentAt, saved.ID)
+	return result, nil
+}
+
+func newMessageEventData(saved *models.Message) map[string]interface{} {
+	clientMessageID := ""
+	if saved.ClientMessageID != nil {
+		clientMessageID = *saved.ClientMessageID
+	}
+
+	eventData := map[string]interface{}{
+		"message_id":        strconv.Itoa(saved.ID),
+		"sender_id":         strconv.Itoa(saved.SenderID),
+		"username":          saved.Username,
+		"content":           saved.Content,
+		"chat_id":           saved.ChatID,
+		"seq":               saved.Seq,
+		"sent_at":           saved.SentAt.Format(time.RFC3339),
+		"client_message_id": clientMessageID,
+	}
+	if saved.ReplyTo != nil {
+		eventData["reply_to"] = saved.ReplyTo
+	}
+	if saved.ForwardedFrom != nil {
+		eventData["forwarded_from"] = saved.ForwardedFrom
+	}
+	if len(saved.Files) > 0 {
+		eventData["files"] = saved.Files
+	}
+	return eventData
+}
+
+func (c *wsConnection) handleForwardMessage(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.ChatID <= 0 || msg.SourceChatID <= 0 || len(msg.Messages) == 0 {
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id, source_chat_id and messages are required")
+	}
+	if len(msg.Messages) > maxForwardBatch {
+		return nil, newWSError(ErrCodeInvalidRequest, "Too many messages to forward at once")
+	}
+
+	for _, chatID := range []int{msg.SourceChatID, msg.ChatID} {
+		isParticipant, err := chatService.IsUserInChat(c.ctx, chatID, c.userID)
+		if err != nil {
+			log.Printf("Error checking user %d in chat %d: %v", c.userID, chatID, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to check chat membership")
+		}
+		if !isParticipant {
+			return nil, newWSError(ErrCodeNotParticipant, "User is not a participant of chat "+strconv.Itoa(chatID))
+		}
+	}
+
+	messages := make([]models.Message, 0, len(msg.Messages))
+	for _, item := range msg.Messages {
+		if item.MessageID <= 0 || (item.Content == "" && len(item.FileIDs) == 0) {
+			return nil, newWSError(ErrCodeInvalidRequest, "Every forwarded message needs message_id and content or file_ids")
+		}
+		if len(item.FileIDs) > maxMessageFiles {
+			return nil, newWSError(ErrCodeInvalidRequest, "Too many files in one message")
+		}
 
-			switch createChatReq.Type {
-			case "direct":
-				if createChatReq.RecipientEmail == nil || *createChatReq.RecipientEmail == "" {
-					log.Printf("Invalid create_chat request from user %d: recipient_email is required for direct chat", userID)
-					continue
-				}
-
-				recipient, err := userService.GetUserByEmail(r.Context(), *createChatReq.RecipientEmail)
-				if err != nil {
-					log.Printf("Error getting user by email %s: %v", *createChatReq.RecipientEmail, err)
-					continue
-				}
-
-				existingChatID, err := chatService.CheckExistingPrivateChat(r.Context(), userID, recipient.ID)
-				if err != nil {
-					log.Printf("Error checking existing private chat: %v", err)
-					continue
-				}
-
-				if existingChatID > 0 {
-					clientPool.BroadcastEvent(existingChatID, "new_chat", map[string]int{
-						"chat_id": existingChatID,
-					})
-					log.Printf("Existing private chat found with ID %d", existingChatID)
-					continue
-				}
-
-				chatID, err := chatService.CreateChat(r.Context(), userID, recipient.ID, "direct", nil, nil)
-				if err != nil {
-					log.Printf("Error creating direct chat between user %d and recipient %d: %v", userID, recipient.ID, err)
-					continue
-				}
-
-				encryptedKeys := make(map[int]string)
-				for _, key := range createChatReq.EncryptedKeys {
-					user, err := userService.GetUserByEmail(r.Context(), key.Email)
-					if err != nil {
-						log.Printf("Error getting user by email %s: %v", key.Email, err)
-						continue
-					}
-					encryptedKeys[user.ID] = key.EncryptedKey
-				}
-
-				if _, exists := encryptedKeys[userID]; !exists {
-					log.Printf("Encrypted key is missing for creator user %d", userID)
-					continue
-				}
-
-				if err := chatService.AddParticipants(r.Context(), chatID, []int{userID, recipient.ID}, encryptedKeys); err != nil {
-					log.Printf("Error adding participants to chat %d: %v", chatID, err)
-					continue
-				}
-
-				clientPool.BroadcastEvent(chatID, "new_chat", map[string]int{
-					"chat_id": chatID,
-				})
-				log.Printf("Direct chat created with ID %d between user %d and recipient %d", chatID, userID, recipient.ID)
-			case "group":
-				if createChatReq.Name == nil || *createChatReq.Name == "" || len(createChatReq.Emails) == 0 || len(createChatReq.EncryptedKeys) == 0 {
-					log.Printf("Invalid create_chat request from user %d: name, emails, and encrypted keys are required for group chat", userID)
-					continue
-				}
-
-				userIDs, err := userService.GetUserIDsByEmails(r.Context(), createChatReq.Emails)
-				if err != nil {
-					log.Printf("Error getting user IDs by emails: %v", err)
-					continue
-				}
-
-				userIDs = append(userIDs, userID)
-
-				chatID, err := chatService.CreateChat(r.Context(), userID, 0, "group", createChatReq.Name, nil)
-				if err != nil {
-					log.Printf("Error creating group chat: %v", err)
-					continue
-				}
-
-				encryptedKeys := make(map[int]string)
-				for _, key := range createChatReq.EncryptedKeys {
-					user, err := userService.GetUserByEmail(r.Context(), key.Email)
-					if err != nil {
-						log.Printf("Error getting user by email %s: %v", key.Email, err)
-						continue
-					}
-					encryptedKeys[user.ID] = key.EncryptedKey
-				}
-
-				if err := chatService.AddParticipants(r.Context(), chatID, userIDs, encryptedKeys); err != nil {
-					log.Printf("Error adding participants to chat %d: %v", chatID, err)
-					continue
-				}
-
-				clientPool.BroadcastEvent(chatID, "new_chat", map[string]int{
-					"chat_id": chatID,
-				})
-				log.Printf("Group chat created with ID %d and name %s", chatID, *createChatReq.Name)
-			case "channel":
-				if createChatReq.Name == nil || *createChatReq.Name == "" || len(createChatReq.Emails) == 0 || len(createChatReq.EncryptedKeys) == 0 || createChatReq.RawAESKey == nil {
-					log.Printf("Invalid create_channel request from user %d: name, emails, encrypted keys, and raw_aes_key are required for channel", userID)
-					continue
-				}
-
-				userIDs, err := userService.GetUserIDsByEmails(r.Context(), createChatReq.Emails)
-				if err != nil {
-					log.Printf("Error getting user IDs by emails: %v", err)
-					continue
-				}
-
-				userIDs = append(userIDs, userID)
-
-				chatID, err := chatService.CreateChat(r.Context(), userID, 0, "channel", createChatReq.Name, createChatReq.RawAESKey)
-				if err != nil {
-					log.Printf("Error creating channel: %v", err)
-					continue
-				}
-
-				encryptedKeys := make(map[int]string)
-				for _, key := range createChatReq.EncryptedKeys {
-					user, err := userService.GetUserByEmail(r.Context(), key.Email)
-					if err != nil {
-						log.Printf("Error getting user by email %s: %v", key.Email, err)
-						continue
-					}
-					encryptedKeys[user.ID] = key.EncryptedKey
-				}
-
-				if err := chatService.AddParticipants(r.Context(), chatID, userIDs, encryptedKeys); err != nil {
-					log.Printf("Error adding participants to channel %d: %v", chatID, err)
-					continue
-				}
-
-				clientPool.BroadcastEvent(chatID, "new_chat", map[string]int{
-					"chat_id": chatID,
-				})
-				log.Printf("Channel created with ID %d and name %s", chatID, *createChatReq.Name)
-
-			default:
-				log.Printf("Invalid chat type: %s", createChatReq.Type)
+		source, err := chatService.GetForwardSource(c.ctx, msg.SourceChatID, item.MessageID, msg.HideSender)
+		if err != nil {
+			if errors.Is(err, models.ErrMessageNotFound) {
+				return nil, newWSError(ErrCodeMessageNotFound, "Message "+strconv.Itoa(item.MessageID)+" not found in source chat")
 			}
+			log.Printf("Error loading message %d for forwarding: %v", item.MessageID, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to load message to forward")
+		}
 
-		case "message_read":
-			var rawMsg struct {
-				Event string          `json:"event"`
-				Data  json.RawMessage `json:"data"`
+		message := models.Message{
+			ChatID:        msg.ChatID,
+			SenderID:      c.userID,
+			Username:      c.username,
+			Content:       item.Content,
+			ForwardedFrom: source,
+		}
+		if item.ClientMessageID != "" {
+			if !utils.IsValidUUID(item.ClientMessageID) {
+				return nil, newWSError(ErrCodeInvalidRequest, "client_message_id must be a UUID")
 			}
-			var readMsgReq struct {
-				ChatID            int `json:"chat_id"`
-				LastReadMessageID int `json:"last_read_message_id"`
+			clientMessageID := item.ClientMessageID
+			message.ClientMessageID = &clientMessageID
+		}
+		// The files are copied from the source message, which the forwarder
+		// can read as a participant of the source chat.
+		sourceMessageID := item.MessageID
+		seenFiles := make(map[int]bool, len(item.FileIDs))
+		for _, fileID := range item.FileIDs {
+			if fileID <= 0 || seenFiles[fileID] {
+				return nil, newWSError(ErrCodeInvalidRequest, "file_ids must be unique positive IDs")
 			}
+			seenFiles[fileID] = true
+			message.Files = append(message.Files, models.File{ID: fileID, ChatID: msg.SourceChatID, MessageID: &sourceMessageID})
+		}
+		messages = append(messages, message)
+	}
 
-			err := json.Unmarshal([]byte(msg.Content), &rawMsg)
-			if err != nil {
-				log.Printf("Invalid message format from user %d: %v", userID, err)
-				continue
-			}
+	// Copied files count against the forwarder and the target chat.
+	quotas, err := storageQuotas(c.ctx, c.userID, msg.ChatID)
+	if err != nil {
+		log.Printf("Error getting storage quotas of user %d in chat %d: %v", c.userID, msg.ChatID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to load storage quotas")
+	}
 
-			err = json.Unmarshal(rawMsg.Data, &readMsgReq)
-			if err != nil || readMsgReq.ChatID == 0 || readMsgReq.LastReadMessageID == 0 {
-				log.Printf("Invalid read_messages request from user %d: %v", userID, err)
-				continue
-			}
+	// The batch is saved atomically and only announced once it is committed.
+	saved, created, err := chatService.SaveMessages(c.ctx, messages, quotas)
+	if err != nil {
+		if errors.Is(err, models.ErrFileNotFound) {
+			return nil, newWSError(ErrCodeFileNotFound, "File not found in the forwarded message")
+		}
+		var quotaErr *models.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return nil, newWSError(ErrCodeQuotaExceeded, "Storage quota of the "+quotaErr.Scope+" exceeded")
+		}
+		log.Printf("Error saving forwarded messages: %v", err)
+		return nil, newWSError(ErrCodeInternal, "Failed to forward message")
+	}
 
-			log.Printf("User %d marked messages as read in chat %d up to message ID %d",
-				userID, readMsgReq.ChatID, readMsgReq.LastReadMessageID)
+	forwarded := make([]map[string]interface{}, 0, len(saved))
+	for i, message := range saved {
+		forwarded = append(forwarded, map[string]interface{}{
+			"message_id":        message.ID,
+			"seq":               message.Seq,
+			"sent_at":           message.SentAt.Format(time.RFC3339),
+			"client_message_id": message.ClientMessageID,
+			"duplicate":         !created[i],
+		})
+		if created[i] {
+			pool.GlobalPool.BroadcastEvent(message.ChatID, "new_message", newMessageEventData(message))
+		}
+	}
 
-			messageIDs, senderIDs, err := chatService.MarkMessagesAsRead(
-				r.Context(), readMsgReq.ChatID, userID, readMsgReq.LastReadMessageID)
-			if err != nil {
-				log.Printf("Error marking messages as read in chat %d for user %d: %v", readMsgReq.ChatID, userID, err)
-				continue
-			}
+	log.Printf("User %d forwarded %d messages from chat %d to chat %d", c.userID, len(forwarded), msg.SourceChatID, msg.ChatID)
+	return map[string]interface{}{
+		"chat_id":  msg.ChatID,
+		"messages": forwarded,
+	}, nil
+}
 
-			if len(messageIDs) == 0 {
-				log.Printf("No unread messages found in chat %d for user %d", readMsgReq.ChatID, userID)
-				continue
-			}
+func (c *wsConnection) handleEditMessage(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.ChatID <= 0 || msg.MessageID <= 0 || msg.Content == "" {
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id, message_id and content are required")
+	}
+
+	isParticipant, err := chatService.IsUserInChat(c.ctx, msg.ChatID, c.userID)
+	if err != nil {
+		log.Printf("Error checking user %d in chat %d: %v", c.userID, msg.ChatID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to check chat membership")
+	}
+	if !isParticipant {
+		return nil, newWSError(ErrCodeNotParticipant, "User is not a participant of this chat")
+	}
 
-			readAt := time.Now().UTC().Format(time.RFC3339)
-			eventData := map[string]interface{}{
-				"chat_id":              readMsgReq.ChatID,
-				"message_ids":          messageIDs,
-				"last_read_message_id": readMsgReq.LastReadMessageID,
-				"read_at":              readAt,
+	edited, err := chatService.EditMessage(c.ctx, msg.ChatID, msg.MessageID, c.userID, msg.Content, messageEditWindow)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrMessageNotFound):
+			return nil, newWSError(ErrCodeMessageNotFound, "Message not found in this chat")
+		case errors.Is(err, models.ErrNotMessageSender):
+			return nil, newWSError(ErrCodeForbidden, "Only the sender can edit a message")
+		case errors.Is(err, models.ErrEditWindowExpired):
+			return nil, newWSError(ErrCodeEditWindowExpired, "Message can no longer be edited")
+		}
+		log.Printf("Error editing message %d: %v", msg.MessageID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to edit message")
+	}
+
+	pool.GlobalPool.BroadcastEvent(edited.ChatID, "message_edited", map[string]interface{}{
+		"message_id": strconv.Itoa(edited.ID),
+		"chat_id":    edited.ChatID,
+		"seq":        edited.Seq,
+		"sender_id":  strconv.Itoa(edited.SenderID),
+		"content":    edited.Content,
+		"edited_at":  edited.EditedAt.Format(time.RFC3339),
+	})
+
+	return map[string]interface{}{
+		"message_id": edited.ID,
+		"chat_id":    edited.ChatID,
+		"edited_at":  edited.EditedAt.Format(time.RFC3339),
+	}, nil
+}
+
+func (c *wsConnection) handleDeleteMessage(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.ChatID <= 0 || msg.MessageID <= 0 {
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id and message_id are required")
+	}
+	if msg.Scope != models.DeleteScopeMe && msg.Scope != models.DeleteScopeEveryone {
+		return nil, newWSError(ErrCodeInvalidRequest, "scope must be 'me' or 'everyone'")
+	}
+
+	isParticipant, err := chatService.IsUserInChat(c.ctx, msg.ChatID, c.userID)
+	if err != nil {
+		log.Printf("Error checking user %d in chat %d: %v", c.userID, msg.ChatID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to check chat membership")
+	}
+	if !isParticipant {
+		return nil, newWSError(ErrCodeNotParticipant, "User is not a participant of this chat")
+	}
+
+	eventData := map[string]interface{}{
+		"message_id": strconv.Itoa(msg.MessageID),
+		"chat_id":    msg.ChatID,
+		"scope":      msg.Scope,
+	}
+
+	if msg.Scope == models.DeleteScopeMe {
+		err = chatService.HideMessage(c.ctx, msg.ChatID, msg.MessageID, c.userID)
+		if err != nil {
+			if errors.Is(err, models.ErrMessageNotFound) {
+				return nil, newWSError(ErrCodeMessageNotFound, "Message not found in this chat")
 			}
+			log.Printf("Error hiding message %d for user %d: %v", msg.MessageID, c.userID, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to delete message")
+		}
+
+		// Other devices of the same user have to hide the message as well.
+		pool.GlobalPool.SendToUser(c.userID, "message_deleted", eventData)
+		return map[string]interface{}{
+			"message_id": msg.MessageID,
+			"chat_id":    msg.ChatID,
+			"scope":      msg.Scope,
+		}, nil
+	}
+
+	deleted, err := chatService.DeleteMessageForEveryone(c.ctx, msg.ChatID, msg.MessageID, c.userID, messageDeleteWindow)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrMessageNotFound):
+			return nil, newWSError(ErrCodeMessageNotFound, "Message not found in this chat")
+		case errors.Is(err, models.ErrNotMessageSender):
+			return nil, newWSError(ErrCodeForbidden, "Only the sender or a chat admin can delete a message for everyone")
+		case errors.Is(err, models.ErrDeleteWindowExpired):
+			return nil, newWSError(ErrCodeDeleteWindowExpired, "Message can no longer be deleted for everyone")
+		}
+		log.Printf("Error deleting message %d: %v", msg.MessageID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to delete message")
+	}
+
+	eventData["seq"] = deleted.Seq
+	eventData["deleted_at"] = deleted.DeletedAt.Format(time.RFC3339)
+	pool.GlobalPool.BroadcastEvent(deleted.ChatID, "message_deleted", eventData)
+
+	return map[string]interface{}{
+		"message_id": deleted.ID,
+		"chat_id":    deleted.ChatID,
+		"scope":      msg.Scope,
+		"deleted_at": deleted.DeletedAt.Format(time.RFC3339),
+	}, nil
+}
+
+func (c *wsConnection) handleReaction(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.ChatID <= 0 || msg.MessageID <= 0 || msg.Emoji == "" {
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id, message_id and emoji are required")
+	}
+	if len(msg.Emoji) > 32 || !utils.IsSingleEmoji(msg.Emoji) {
+		return nil, newWSError(ErrCodeInvalidRequest, "emoji must be a single emoji")
+	}
+	// Reactions added before the list changed can still be removed.
+	if msg.Event == "add_reaction" && reactionEmojis != nil && !reactionEmojis[msg.Emoji] {
+		return nil, newWSError(ErrCodeForbidden, "This emoji cannot be used as a reaction")
+	}
+
+	isParticipant, err := chatService.IsUserInChat(c.ctx, msg.ChatID, c.userID)
+	if err != nil {
+		log.Printf("Error checking user %d in chat %d: %v", c.userID, msg.ChatID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to check chat membership")
+	}
+	if !isParticipant {
+		return nil, newWSError(ErrCodeNotParticipant, "User is not a participant of this chat")
+	}
+
+	chatType, err := chatService.GetChatType(c.ctx, msg.ChatID)
+	if err != nil {
+		log.Printf("Error getting type of chat %d: %v", msg.ChatID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to load chat")
+	}
+	if !models.PolicyForChatType(chatType).AllowReactions {
+		return nil, newWSError(ErrCodeForbidden, "Reactions are not allowed in this chat")
+	}
+
+	var changed bool
+	action := "added"
+	if msg.Event == "add_reaction" {
+		changed, err = chatService.AddReaction(c.ctx, msg.ChatID, msg.MessageID, c.userID, msg.Emoji)
+	} else {
+		action = "removed"
+		changed, err = chatService.RemoveReaction(c.ctx, msg.ChatID, msg.MessageID, c.userID, msg.Emoji)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrMessageNotFound) {
+			return nil, newWSError(ErrCodeMessageNotFound, "Message not found in this chat")
+		}
+		log.Printf("Error updating reaction on message %d: %v", msg.MessageID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to update reaction")
+	}
+
+	result := map[string]interface{}{
+		"chat_id":    msg.ChatID,
+		"message_id": msg.MessageID,
+		"emoji":      msg.Emoji,
+		"changed":    changed,
+	}
+	if !changed {
+		return result, nil
+	}
+
+	reactions, err := chatService.GetReactions(c.ctx, msg.MessageID)
+	if err != nil {
+		log.Printf("Error getting reactions of message %d: %v", msg.MessageID, err)
+		return result, nil
+	}
+
+	counts := make([]map[string]interface{}, 0, len(reactions))
+	for _, reaction := range reactions {
+		counts = append(counts, map[string]interface{}{
+			"emoji": reaction.Emoji,
+			"count": reaction.Count,
+		})
+	}
+
+	pool.GlobalPool.BroadcastEvent(msg.ChatID, "reaction_updated", map[string]interface{}{
+		"chat_id":    msg.ChatID,
+		"message_id": strconv.Itoa(msg.MessageID),
+		"user_id":    c.userID,
+		"emoji":      msg.Emoji,
+		"action":     action,
+		"reactions":  counts,
+	})
+
+	return result, nil
+}
+
+func (c *wsConnection) handleCreateChat(msg wsFrame) (map[string]interface{}, *wsError) {
+	log.Printf("WEBSOCKET create_chat")
+	var createChatReq struct {
+		RecipientEmail *string               `json:"recipient_email"`
+		Type           string                `json:"type"`
+		Name           *string               `json:"name"`
+		Emails         []string              `json:"emails"`
+		EncryptedKeys  []models.EncryptedKey `json:"encrypted_keys"`
+		RawAESKey      *string               `json:"raw_aes_key"`
+	}
+	err := json.Unmarshal([]byte(msg.Content), &createChatReq)
+	if err != nil || createChatReq.Type == "" {
+		log.Printf("Invalid create_chat request from user %d: %v", c.userID, err)
+		return nil, newWSError(ErrCodeInvalidRequest, "Invalid create_chat payload")
+	}
+
+	switch createChatReq.Type {
+	case "direct":
+		if createChatReq.RecipientEmail == nil || *createChatReq.RecipientEmail == "" {
+			return nil, newWSError(ErrCodeInvalidRequest, "recipient_email is required for direct chat")
+		}
+
+		recipient, err := userService.GetUserByEmail(c.ctx, *createChatReq.RecipientEmail)
+		if err != nil {
+			log.Printf("Error getting user by email %s: %v", *createChatReq.RecipientEmail, err)
+			return nil, newWSError(ErrCodeUserNotFound, "Recipient not found")
+		}
+
+		existingChatID, err := chatService.CheckExistingPrivateChat(c.ctx, c.userID, recipient.ID)
+		if err != nil {
+			log.Printf("Error checking existing private chat: %v", err)
+			return nil, newWSError(ErrCodeInternal, "Failed to check existing chat")
+		}
+
+		if existingChatID > 0 {
+			pool.GlobalPool.BroadcastEvent(existingChatID, "new_chat", map[string]int{
+				"chat_id": existingChatID,
+			})
+			log.Printf("Existing private chat found with ID %d", existingChatID)
+			return map[string]interface{}{
+				"chat_id":  existingChatID,
+				"existing": true,
+			}, nil
+		}
+
+		encryptedKeys := c.resolveEncryptedKeys(createChatReq.EncryptedKeys)
+		if _, exists := encryptedKeys[c.userID]; !exists {
+			return nil, newWSError(ErrCodeMissingEncryptedKey, "Encrypted key is missing for the chat creator")
+		}
+
+		chatID, err := chatService.CreateChat(c.ctx, c.userID, recipient.ID, "direct", nil, nil)
+		if err != nil {
+			log.Printf("Error creating direct chat between user %d and recipient %d: %v", c.userID, recipient.ID, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to create chat")
+		}
+
+		if err := chatService.AddParticipants(c.ctx, chatID, []int{c.userID, recipient.ID}, encryptedKeys); err != nil {
+			log.Printf("Error adding participants to chat %d: %v", chatID, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to add participants")
+		}
+
+		pool.GlobalPool.BroadcastEvent(chatID, "new_chat", map[string]int{
+			"chat_id": chatID,
+		})
+		log.Printf("Direct chat created with ID %d between user %d and recipient %d", chatID, c.userID, recipient.ID)
+		return map[string]interface{}{"chat_id": chatID}, nil
+
+	case "group", "channel":
+		if createChatReq.Name == nil || *createChatReq.Name == "" || len(createChatReq.Emails) == 0 || len(createChatReq.EncryptedKeys) == 0 {
+			return nil, newWSError(ErrCodeInvalidRequest, "name, emails and encrypted_keys are required")
+		}
+		if createChatReq.Type == "channel" && createChatReq.RawAESKey == nil {
+			return nil, newWSError(ErrCodeInvalidRequest, "raw_aes_key is required for channel")
+		}
+
+		userIDs, err := userService.GetUserIDsByEmails(c.ctx, createChatReq.Emails)
+		if err != nil {
+			log.Printf("Error getting user IDs by emails: %v", err)
+			return nil, newWSError(ErrCodeUserNotFound, "No users found for the provided emails")
+		}
+
+		userIDs = append(userIDs, c.userID)
+
+		encryptedKeys := c.resolveEncryptedKeys(createChatReq.EncryptedKeys)
+		if _, exists := encryptedKeys[c.userID]; !exists {
+			return nil, newWSError(ErrCodeMissingEncryptedKey, "Encrypted key is missing for the chat creator")
+		}
+
+		var rawAESKey *string
+		if createChatReq.Type == "channel" {
+			rawAESKey = createChatReq.RawAESKey
+		}
+
+		chatID, err := chatService.CreateChat(c.ctx, c.userID, 0, createChatReq.Type, createChatReq.Name, rawAESKey)
+		if err != nil {
+			log.Printf("Error creating %s chat: %v", createChatReq.Type, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to create chat")
+		}
+
+		if err := chatService.AddParticipants(c.ctx, chatID, userIDs, encryptedKeys); err != nil {
+			log.Printf("Error adding participants to chat %d: %v", chatID, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to add participants")
+		}
+
+		pool.GlobalPool.BroadcastEvent(chatID, "new_chat", map[string]int{
+			"chat_id": chatID,
+		})
+		log.Printf("%s chat created with ID %d and name %s", createChatReq.Type, chatID, *createChatReq.Name)
+		return map[string]interface{}{"chat_id": chatID}, nil
+
+	default:
+		log.Printf("Invalid chat type: %s", createChatReq.Type)
+		return nil, newWSError(ErrCodeInvalidRequest, "Invalid chat type: "+createChatReq.Type)
+	}
+}
+
+func (c *wsConnection) resolveEncryptedKeys(keys []models.EncryptedKey) map[int]string {
+	encryptedKeys := make(map[int]string)
+	for _, key := range keys {
+		user, err := userService.GetUserByEmail(c.ctx, key.Email)
+		if err != nil {
+			log.Printf("Error getting user by email %s: %v", key.Email, err)
+			continue
+		}
+		encryptedKeys[user.ID] = key.EncryptedKey
+	}
+	return encryptedKeys
+}
+
+func (c *wsConnection) handleMessageRead(msg wsFrame) (map[string]interface{}, *wsError) {
+	var rawMsg struct {
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}
+	var readMsgReq struct {
+		ChatID            int `json:"chat_id"`
+		LastReadMessageID int `json:"last_read_message_id"`
+	}
+
+	err := json.Unmarshal([]byte(msg.Content), &rawMsg)
+	if err != nil {
+		log.Printf("Invalid message format from user %d: %v", c.userID, err)
+		return nil, newWSError(ErrCodeInvalidRequest, "Invalid message_read payload")
+	}
+
+	err = json.Unmarshal(rawMsg.Data, &readMsgReq)
+	if err != nil || readMsgReq.ChatID == 0 || readMsgReq.LastReadMessageID == 0 {
+		log.Printf("Invalid read_messages request from user %d: %v", c.userID, err)
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id and last_read_message_id are required")
+	}
+
+	log.Printf("User %d marked messages as read in chat %d up to message ID %d",
+		c.userID, readMsgReq.ChatID, readMsgReq.LastReadMessageID)
+
+	messageIDs, senderIDs, err := chatService.MarkMessagesAsRead(
+		c.ctx, readMsgReq.ChatID, c.userID, readMsgReq.LastReadMessageID)
+	if err != nil {
+		log.Printf("Error marking messages as read in chat %d for user %d: %v", readMsgReq.ChatID, c.userID, err)
+		switch {
+		case errors.Is(err, models.ErrUserNotParticipant):
+			return nil, newWSError(ErrCodeNotParticipant, "You are not a participant of this chat")
+		case errors.Is(err, models.ErrMessageNotFound):
+			return nil, newWSError(ErrCodeMessageNotFound, "Message not found in this chat")
+		}
+		return nil, newWSError(ErrCodeInternal, "Failed to mark messages as read")
+	}
 
-			for _, senderID := range senderIDs {
-				if senderID == userID {
-					continue
-				}
-
-				client := clientPool.GetClient(senderID)
-				if client == nil {
-					log.Printf("Client %d not found in pool", senderID)
-					continue
-				}
-
-				err := client.Conn.WriteJSON(map[string]interface{}{
-					"event": "message_read",
-					"data":  eventData,
-				})
-				if err != nil {
-					log.Printf("Error sending message_read event to user %d: %v", senderID, err)
-					client.Conn.Close()
-					clientPool.RemoveClient(senderID)
-				} else {
-					log.Printf("Sent message_read event to user %d", senderID)
-				}
+	result := map[string]interface{}{
+		"chat_id":     readMsgReq.ChatID,
+		"message_ids": messageIDs,
+	}
+
+	if len(messageIDs) == 0 {
+		log.Printf("No unread messages found in chat %d for user %d", readMsgReq.ChatID, c.userID)
+		return result, nil
+	}
+
+	readAt := time.Now().UTC().Format(time.RFC3339)
+	eventData := map[string]interface{}{
+		"chat_id":              readMsgReq.ChatID,
+		"user_id":              c.userID,
+		"username":             c.username,
+		"message_ids":          messageIDs,
+		"last_read_message_id": readMsgReq.LastReadMessageID,
+		"read_at":              readAt,
+	}
+
+	for _, senderID := range senderIDs {
+		if senderID == c.userID {
+			continue
+		}
+
+		pool.GlobalPool.SendToUser(senderID, "message_read", eventData)
+		log.Printf("Sent message_read event to user %d", senderID)
+	}
+
+	log.Printf("User %d marked messages [%v] as read in chat %d", c.userID, messageIDs, readMsgReq.ChatID)
+	return result, nil
+}
+
+func (c *wsConnection) handleMessageDelivered(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.ChatID <= 0 || msg.MessageID <= 0 {
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id and message_id are required")
+	}
+
+	messageIDs, senderIDs, err := chatService.MarkMessagesAsDelivered(c.ctx, msg.ChatID, c.userID, msg.MessageID)
+	if err != nil {
+		log.Printf("Error marking messages as delivered in chat %d for user %d: %v", msg.ChatID, c.userID, err)
+		switch {
+		case errors.Is(err, models.ErrUserNotParticipant):
+			return nil, newWSError(ErrCodeNotParticipant, "You are not a participant of this chat")
+		case errors.Is(err, models.ErrMessageNotFound):
+			return nil, newWSError(ErrCodeMessageNotFound, "Message not found in this chat")
+		}
+		return nil, newWSError(ErrCodeInternal, "Failed to mark messages as delivered")
+	}
+
+	result := map[string]interface{}{
+		"chat_id":     msg.ChatID,
+		"message_ids": messageIDs,
+	}
+
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	eventData := map[string]interface{}{
+		"chat_id":                   msg.ChatID,
+		"user_id":                   c.userID,
+		"username":                  c.username,
+		"message_ids":               messageIDs,
+		"last_delivered_message_id": msg.MessageID,
+		"delivered_at":              time.Now().UTC().Format(time.RFC3339),
+	}
+
+	for _, senderID := range senderIDs {
+		if senderID == c.userID {
+			continue
+		}
+
+		pool.GlobalPool.SendToUser(senderID, "message_delivered", eventData)
+		log.Printf("Sent message_delivered event to user %d", senderID)
+	}
+
+	log.Printf("User %d received messages [%v] in chat %d", c.userID, messageIDs, msg.ChatID)
+	return result, nil
+}
+
+func (c *wsConnection) handleTyping(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.ChatID <= 0 {
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id is required")
+	}
+
+	if msg.Event == "typing_start" {
+		if time.Since(c.typingSentAt[msg.ChatID]) < typingThrottle {
+			return map[string]interface{}{"chat_id": msg.ChatID, "throttled": true}, nil
+		}
+	} else if _, typing := c.typingSentAt[msg.ChatID]; !typing {
+		return map[string]interface{}{"chat_id": msg.ChatID}, nil
+	}
+
+	isParticipant, err := chatService.IsUserInChat(c.ctx, msg.ChatID, c.userID)
+	if err != nil {
+		log.Printf("Error checking user %d in chat %d: %v", c.userID, msg.ChatID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to check chat membership")
+	}
+	if !isParticipant {
+		return nil, newWSError(ErrCodeNotParticipant, "User is not a participant of this chat")
+	}
+
+	if msg.Event == "typing_start" {
+		c.typingSentAt[msg.ChatID] = time.Now()
+	} else {
+		delete(c.typingSentAt, msg.ChatID)
+	}
+
+	pool.GlobalPool.BroadcastEphemeral(msg.ChatID, c.userID, msg.Event, map[string]interface{}{
+		"chat_id":  msg.ChatID,
+		"user_id":  c.userID,
+		"username": c.username,
+	})
+
+	return map[string]interface{}{"chat_id": msg.ChatID}, nil
+}
+
+// stopTyping clears typing indicators left behind by a closed connection.
+func (c *wsConnection) stopTyping() {
+	for chatID := range c.typingSentAt {
+		pool.GlobalPool.BroadcastEphemeral(chatID, c.userID, "typing_stop", map[string]interface{}{
+			"chat_id":  chatID,
+			"user_id":  c.userID,
+			"username": c.username,
+		})
+	}
+}
+
+func (c *wsConnection) handleThreadRead(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.ChatID <= 0 || msg.ThreadRootID <= 0 || msg.MessageID <= 0 {
+		return nil, newWSError(ErrCodeInvalidRequest, "chat_id, thread_root_id and message_id are required")
+	}
+
+	isParticipant, err := chatService.IsUserInChat(c.ctx, msg.ChatID, c.userID)
+	if err != nil {
+		log.Printf("Error checking user %d in chat %d: %v", c.userID, msg.ChatID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to check chat membership")
+	}
+	if !isParticipant {
+		return nil, newWSError(ErrCodeNotParticipant, "User is not a participant of this chat")
+	}
+
+	lastReadSeq, err := chatService.MarkThreadAsRead(c.ctx, msg.ChatID, msg.ThreadRootID, c.userID, msg.MessageID)
+	if err != nil {
+		if errors.Is(err, models.ErrMessageNotFound) {
+			return nil, newWSError(ErrCodeMessageNotFound, "Message not found in this thread")
+		}
+		log.Printf("Error marking thread %d as read for user %d: %v", msg.ThreadRootID, c.userID, err)
+		return nil, newWSError(ErrCodeInternal, "Failed to mark thread as read")
+	}
+
+	result := map[string]interface{}{
+		"chat_id":              msg.ChatID,
+		"thread_root_id":       msg.ThreadRootID,
+		"last_read_message_id": msg.MessageID,
+		"last_read_seq":        lastReadSeq,
+	}
+
+	// Keep the unread state of the user's other devices in sync.
+	pool.GlobalPool.SendToUser(c.userID, "thread_read", result)
+	return result, nil
+}
+
+func (c *wsConnection) handleResume(msg wsFrame) (map[string]interface{}, *wsError) {
+	if msg.Cursor < 0 {
+		return nil, newWSError(ErrCodeInvalidRequest, "cursor must not be negative")
+	}
+
+	// Live events are held back until every missed event has been queued,
+	// so the client sees cursors in order. Replay pages through the log
+	// until it is caught up rather than leaving a gap for live events.
+	cursor := msg.Cursor
+	c.client.BeginReplay()
+	defer func() { c.client.EndReplay(cursor) }()
+
+	replayed := 0
+	for {
+		events, err := eventService.GetEventsSince(c.ctx, c.userID, cursor, resumeBatchSize)
+		var expired *models.CursorExpiredError
+		if errors.As(err, &expired) {
+			return map[string]interface{}{
+				"replayed":        replayed,
+				"cursor":          expired.Cursor,
+				"resync_required": true,
+			}, nil
+		}
+		if err != nil {
+			log.Printf("Error getting events for user %d since %d: %v", c.userID, cursor, err)
+			return nil, newWSError(ErrCodeInternal, "Failed to load missed events")
+		}
+
+		for _, event := range events {
+			if !c.client.Replay(event.EventType, event.Payload, event.Cursor) {
+				return nil, newWSError(ErrCodeInternal, "Failed to replay missed events")
 			}
+			cursor = event.Cursor
+			replayed++
+		}
 
-			log.Printf("User %d marked messages [%v] as read in chat %d", userID, messageIDs, readMsgReq.ChatID)
+		if len(events) < resumeBatchSize {
+			break
 		}
 	}
+
+	log.Printf("Replayed %d events to user %d since cursor %d", replayed, c.userID, msg.Cursor)
+	return map[string]interface{}{
+		"replayed":        replayed,
+		"cursor":          cursor,
+		"resync_required": false,
+	}, nil
 }
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"SecureMessenger/server/internal/config"
+	"SecureMessenger/server/internal/pool"
+)
+
+const (
+	ErrCodeInvalidFrame        = "invalid_frame"
+	ErrCodeInvalidRequest      = "invalid_request"
+	ErrCodeUnknownEvent        = "unknown_event"
+	ErrCodeNotParticipant      = "not_participant"
+	ErrCodeUserNotFound        = "user_not_found"
+	ErrCodeMessageNotFound     = "message_not_found"
+	ErrCodeFileNotFound        = "file_not_found"
+	ErrCodeQuotaExceeded       = "quota_exceeded"
+	ErrCodeForbidden           = "forbidden"
+	ErrCodeEditWindowExpired   = "edit_window_expired"
+	ErrCodeDeleteWindowExpired = "delete_window_expired"
+	ErrCodeMissingEncryptedKey = "missing_encrypted_key"
+	ErrCodeInternal            = "internal_error"
+)
+
+var (
+	typingThrottle      = config.GetDuration("WS_TYPING_THROTTLE", 3*time.Second)
+	messageEditWindow   = config.GetDuration("MESSAGE_EDIT_WINDOW", 48*time.Hour)
+	messageDeleteWindow = config.GetDuration("MESSAGE_DELETE_WINDOW", 48*time.Hour)
+	maxForwardBatch     = config.GetInt("MAX_FORWARD_BATCH", 100)
+	maxMessageFiles     = config.GetInt("MAX_MESSAGE_FILES", 10)
+
+	// When set, only the listed emoji can be added as reactions.
+	reactionEmojis = parseEmojiList(config.GetString("REACTION_EMOJIS", ""))
+)
+
+// parseEmojiList parses a comma separated list of emoji. An empty list
+// allows every emoji.
+func parseEmojiList(value string) map[string]bool {
+	if value == "" {
+		return nil
+	}
+
+	emojis := make(map[string]bool)
+	for _, emoji := range strings.Split(value, ",") {
+		if emoji = strings.TrimSpace(emoji); emoji != "" {
+			emojis[emoji] = true
+		}
+	}
+	return emojis
+}
+
+type wsFrame struct {
+	Event           string `json:"event"`
+	RequestID       string `json:"request_id"`
+	ChatID          int    `json:"chat_id"`
+	MessageID       int    `json:"message_id"`
+	ReplyToID       int    `json:"reply_to_message_id"`
+	ThreadRootID    int    `json:"thread_root_id"`
+	Content         string `json:"content"`
+	ClientMessageID string `json:"client_message_id"`
+	Cursor          int64  `json:"cursor"`
+	Scope           string `json:"scope"`
+	Emoji           string `json:"emoji"`
+	SourceChatID    int    `json:"source_chat_id"`
+	HideSender      bool   `json:"hide_sender"`
+
+	FileIDs  []int           `json:"file_ids"`
+	Messages []wsForwardItem `json:"messages"`
+}
+
+type wsForwardItem struct {
+	MessageID       int    `json:"message_id"`
+	Content         string `json:"content"`
+	ClientMessageID string `json:"client_message_id"`
+	FileIDs         []int  `json:"file_ids"`
+}
+
+type wsError struct {
+	Code    string
+	Message string
+}
+
+func newWSError(code, message string) *wsError {
+	return &wsError{Code: code, Message: message}
+}
+
+type wsConnection struct {
+	ctx      context.Context
+	userID   int
+	username string
+	client   *pool.Client
+
+	typingSentAt map[int]time.Time
+}
+
+func (c *wsConnection) sendAck(frame wsFrame, data map[string]interface{}) {
+	ack := map[string]interface{}{
+		"request_id": frame.RequestID,
+		"event":      frame.Event,
+	}
+	for key, value := range data {
+		ack[key] = value
+	}
+
+	if !c.client.Send("ack", ack) {
+		log.Printf("Failed to send ack for '%s' to user %d", frame.Event, c.userID)
+	}
+}
+
+func (c *wsConnection) sendError(frame wsFrame, wsErr *wsError) {
+	log.Printf("Event '%s' from user %d failed: %s (%s)", frame.Event, c.userID, wsErr.Code, wsErr.Message)
+
+	if !c.client.Send("error", map[string]interface{}{
+		"request_id": frame.RequestID,
+		"event":      frame.Event,
+		"code":       wsErr.Code,
+		"message":    wsErr.Message,
+	}) {
+		log.Printf("Failed to send error for '%s' to user %d", frame.Event, c.userID)
+	}
+}
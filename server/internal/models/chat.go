@@ -15,11 +15,30 @@ type Chat struct {
 	RawAESKey        string    `json:"raw_aes_key,omitempty"`
 }
 
+// ChatPolicy describes which message interactions a chat type allows.
+type ChatPolicy struct {
+	AllowReplies   bool
+	AllowReactions bool
+}
+
+func PolicyForChatType(chatType string) ChatPolicy {
+	switch chatType {
+	case "channel":
+		return ChatPolicy{AllowReplies: false, AllowReactions: true}
+	default:
+		return ChatPolicy{AllowReplies: true, AllowReactions: true}
+	}
+}
+
 type ChatParticipant struct {
-	ID       int       `json:"id" db:"id"`
-	ChatID   int       `json:"chat_id" db:"chat_id"`
-	UserID   int       `json:"user_id" db:"user_id"`
-	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+	ID               int        `json:"id" db:"id"`
+	ChatID           int        `json:"chat_id" db:"chat_id"`
+	UserID           int        `json:"user_id" db:"user_id"`
+	JoinedAt         time.Time  `json:"joined_at" db:"joined_at"`
+	LastReadSeq      int64      `json:"last_read_seq" db:"last_read_seq"`
+	LastReadAt       *time.Time `json:"last_read_at" db:"last_read_at"`
+	LastDeliveredSeq int64      `json:"last_delivered_seq" db:"last_delivered_seq"`
+	LastDeliveredAt  *time.Time `json:"last_delivered_at" db:"last_delivered_at"`
 }
 
 type ChatWithLastMessage struct {
@@ -3,7 +3,21 @@ package models
 import "errors"
 
 var (
-	ErrUserNotFound       = errors.New("user not found")
-	ErrChatNotFound       = errors.New("chat not found")
-	ErrUserNotParticipant = errors.New("user is not a participant")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrChatNotFound        = errors.New("chat not found")
+	ErrUserNotParticipant  = errors.New("user is not a participant")
+	ErrMessageNotFound     = errors.New("message not found")
+	ErrNotMessageSender    = errors.New("user is not the sender of the message")
+	ErrEditWindowExpired   = errors.New("message edit window has expired")
+	ErrDeleteWindowExpired = errors.New("message delete window has expired")
+	ErrPinLimitReached     = errors.New("pinned messages limit reached")
+	ErrFileNotFound        = errors.New("file not found")
+	ErrUploadNotFound      = errors.New("upload not found")
+	ErrUploadConflict      = errors.New("upload offset does not match")
+	ErrUploadLocked        = errors.New("upload is in use by another request")
+	ErrQuotaExceeded       = errors.New("storage quota exceeded")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrCursorExpired       = errors.New("event cursor expired")
 )
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Event struct {
+	Cursor    int64           `json:"cursor" db:"seq"`
+	UserID    int             `json:"-" db:"user_id"`
+	ChatID    *int            `json:"chat_id,omitempty" db:"chat_id"`
+	EventType string          `json:"event" db:"event_type"`
+	Payload   json.RawMessage `json:"data" db:"payload"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// CursorExpiredError is returned for a cursor that is older than the pruned
+// events or was never handed out. The client has to reload its state and
+// continue from Cursor, the newest event of the user.
+type CursorExpiredError struct {
+	Cursor int64
+}
+
+func (e *CursorExpiredError) Error() string {
+	return "event cursor expired"
+}
+
+func (e *CursorExpiredError) Unwrap() error {
+	return ErrCursorExpired
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	MediaTypeImage    = "image"
+	MediaTypeVideo    = "video"
+	MediaTypeAudio    = "audio"
+	MediaTypeDocument = "document"
+)
+
+func IsValidMediaType(mediaType string) bool {
+	switch mediaType {
+	case MediaTypeImage, MediaTypeVideo, MediaTypeAudio, MediaTypeDocument:
+		return true
+	}
+	return false
+}
+
+// MediaTypeForContentType classifies a file by its declared content type.
+// Encrypted blobs are usually uploaded as application/octet-stream, so
+// clients can also state the media type explicitly.
+func MediaTypeForContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return MediaTypeImage
+	case strings.HasPrefix(contentType, "video/"):
+		return MediaTypeVideo
+	case strings.HasPrefix(contentType, "audio/"):
+		return MediaTypeAudio
+	default:
+		return MediaTypeDocument
+	}
+}
+
+// MediaItem is an attachment as listed in a chat's media gallery.
+type MediaItem struct {
+	File
+	SenderID int       `json:"sender_id"`
+	Username string    `json:"username"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+type MediaPage struct {
+	Items      []MediaItem `json:"items"`
+	NextCursor *int        `json:"next_cursor"`
+	HasMore    bool        `json:"has_more"`
+}
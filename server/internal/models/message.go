@@ -4,24 +4,130 @@ import (
 	"time"
 )
 
+const (
+	DeleteScopeMe       = "me"
+	DeleteScopeEveryone = "everyone"
+)
+
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
+
 type Message struct {
-	ID        int        `json:"id" db:"id"`
-	ChatID    int        `json:"chat_id" db:"chat_id"`
-	SenderID  int        `json:"sender_id" db:"sender_id"`
-	Username  string     `json:"username"`
-	Content   string     `json:"content" db:"content"`
-	Encrypted bool       `json:"encrypted" db:"encrypted"`
-	SentAt    time.Time  `json:"sent_at" db:"sent_at"`
-	ReadAt    *time.Time `json:"read_at" db:"read_at"`
+	ID              int         `json:"id" db:"id"`
+	ChatID          int         `json:"chat_id" db:"chat_id"`
+	Seq             int64       `json:"seq" db:"seq"`
+	SenderID        int         `json:"sender_id" db:"sender_id"`
+	Username        string      `json:"username"`
+	Content         string      `json:"content" db:"content"`
+	Encrypted       bool        `json:"encrypted" db:"encrypted"`
+	SentAt          time.Time   `json:"sent_at" db:"sent_at"`
+	ReadAt          *time.Time  `json:"read_at" db:"read_at"`
+	ClientMessageID *string     `json:"client_message_id,omitempty" db:"client_message_id"`
+	EditedAt        *time.Time  `json:"edited_at,omitempty" db:"edited_at"`
+	DeletedAt       *time.Time  `json:"deleted_at,omitempty" db:"deleted_at"`
+	ReplyTo         *MessageRef `json:"reply_to,omitempty" db:"reply_to_message_id"`
+	ThreadRootID    *int        `json:"thread_root_id,omitempty" db:"thread_root_id"`
+	Thread          *ThreadInfo `json:"thread,omitempty"`
+	Reactions       []Reaction  `json:"reactions,omitempty"`
+	ForwardedFrom   *ForwardRef `json:"forwarded_from,omitempty"`
+	Files           []File      `json:"files,omitempty"`
+	Status          string      `json:"status,omitempty"`
+}
+
+// MessageRef is a compact reference to another message, e.g. the one being
+// replied to. Content is empty when the referenced message was deleted.
+type MessageRef struct {
+	ID       int    `json:"id"`
+	SenderID int    `json:"sender_id"`
+	Username string `json:"username"`
+	Content  string `json:"content,omitempty"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// ForwardRef attributes a forwarded message to its original. When the
+// forwarder hides the sender only Hidden is set.
+type ForwardRef struct {
+	MessageID *int   `json:"message_id,omitempty" db:"forwarded_from_message_id"`
+	ChatID    *int   `json:"chat_id,omitempty" db:"forwarded_from_chat_id"`
+	SenderID  *int   `json:"sender_id,omitempty" db:"forwarded_from_sender_id"`
+	Username  string `json:"username,omitempty" db:"forwarded_from_username"`
+	Hidden    bool   `json:"hidden"`
+}
+
+type Reaction struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+type ThreadInfo struct {
+	ReplyCount  int        `json:"reply_count" db:"thread_reply_count"`
+	LastReplyAt *time.Time `json:"last_reply_at" db:"thread_last_reply_at"`
+	UnreadCount int        `json:"unread_count"`
+}
+
+type Thread struct {
+	Root *MessageRef `json:"root"`
+	ThreadInfo
+}
+
+type PinnedMessage struct {
+	ChatID   int        `json:"chat_id" db:"chat_id"`
+	Message  MessageRef `json:"message"`
+	PinnedBy int        `json:"pinned_by" db:"pinned_by"`
+	PinnedAt time.Time  `json:"pinned_at" db:"pinned_at"`
+}
+
+type MessageRead struct {
+	UserID   int        `json:"user_id"`
+	Username string     `json:"username"`
+	ReadAt   *time.Time `json:"read_at"`
+}
+
+type MessageEdit struct {
+	ID        int       `json:"id" db:"id"`
+	MessageID int       `json:"message_id" db:"message_id"`
+	EditorID  int       `json:"editor_id" db:"editor_id"`
+	Content   string    `json:"content" db:"content"`
+	EditedAt  time.Time `json:"edited_at" db:"edited_at"`
+}
+
+type MessageQuery struct {
+	ViewerID     int
+	ThreadRootID int
+	BeforeSeq    *int64
+	AfterSeq     *int64
+	Offset       int
+	Limit        int
+}
+
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor *int64    `json:"next_cursor"`
+	HasMore    bool      `json:"has_more"`
 }
 
 type File struct {
-	ID         int       `json:"id" db:"id"`
-	MessageID  int       `json:"message_id" db:"message_id"`
-	FileURL    string    `json:"file_url" db:"file_url"`
-	FileName   string    `json:"file_name" db:"file_name"`
-	Size       int64     `json:"size" db:"size"`
-	UploadedAt time.Time `json:"uploaded_at" db:"uploaded_at"`
+	ID          int       `json:"id" db:"id"`
+	MessageID   *int      `json:"message_id,omitempty" db:"message_id"`
+	ChatID      int       `json:"chat_id" db:"chat_id"`
+	UploaderID  int       `json:"uploader_id" db:"uploader_id"`
+	FileURL     string    `json:"file_url" db:"file_url"`
+	FileName    string    `json:"file_name" db:"file_name"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	MediaType   string    `json:"media_type" db:"media_type"`
+	Size        int64     `json:"size" db:"size"`
+	StorageKey  string    `json:"-" db:"storage_key"`
+	SHA256      string    `json:"-" db:"-"`
+	UploadedAt  time.Time `json:"uploaded_at" db:"uploaded_at"`
+
+	// The thumbnail is uploaded and encrypted by the client like any other
+	// file; the server only keeps the reference.
+	ThumbnailFileID *int   `json:"thumbnail_file_id,omitempty" db:"thumbnail_file_id"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
 }
 
 type Notification struct {
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	LastSeenEveryone = "everyone"
+	LastSeenContacts = "contacts"
+	LastSeenNobody   = "nobody"
+)
+
+type Presence struct {
+	UserID     int        `json:"user_id"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+
+	// Visible tells whether the viewer may see the user's online status and
+	// last seen time.
+	Visible bool `json:"-"`
+}
+
+func IsValidLastSeenVisibility(visibility string) bool {
+	switch visibility {
+	case LastSeenEveryone, LastSeenContacts, LastSeenNobody:
+		return true
+	}
+	return false
+}
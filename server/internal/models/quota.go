@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	QuotaScopeUser = "user"
+	QuotaScopeChat = "chat"
+
+	QuotaLimitBytes = "bytes"
+	QuotaLimitFiles = "files"
+)
+
+// StorageQuota limits what can be stored. A negative limit disables it, while
+// a limit of 0 allows nothing to be stored.
+type StorageQuota struct {
+	MaxBytes int64 `json:"max_bytes"`
+	MaxFiles int   `json:"max_files"`
+}
+
+// QuotaOverride is set by an admin for a single user or chat. Nil fields
+// keep the default limit.
+type QuotaOverride struct {
+	MaxBytes  *int64    `json:"max_bytes"`
+	MaxFiles  *int      `json:"max_files"`
+	UpdatedBy *int      `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q StorageQuota) WithOverride(override *QuotaOverride) StorageQuota {
+	if override == nil {
+		return q
+	}
+	if override.MaxBytes != nil {
+		q.MaxBytes = *override.MaxBytes
+	}
+	if override.MaxFiles != nil {
+		q.MaxFiles = *override.MaxFiles
+	}
+	return q
+}
+
+// Check returns a *QuotaExceededError if adding files of the given total size
+// to usage would go over the quota.
+func (q StorageQuota) Check(scope string, usage StorageUsage, size int64, files int) error {
+	if q.MaxBytes >= 0 && usage.Bytes+size > q.MaxBytes {
+		return &QuotaExceededError{Scope: scope, Limit: QuotaLimitBytes, Quota: q, Usage: usage}
+	}
+	if q.MaxFiles >= 0 && usage.Files+files > q.MaxFiles {
+		return &QuotaExceededError{Scope: scope, Limit: QuotaLimitFiles, Quota: q, Usage: usage}
+	}
+	return nil
+}
+
+// QuotaCheck is the effective quota of a user or chat that a new file is
+// checked against when it is stored.
+type QuotaCheck struct {
+	Scope    string
+	TargetID int
+	Quota    StorageQuota
+}
+
+type StorageUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int   `json:"files"`
+}
+
+type ChatStorageUsage struct {
+	ChatID   int     `json:"chat_id"`
+	ChatType string  `json:"chat_type"`
+	ChatName *string `json:"chat_name,omitempty"`
+	StorageUsage
+}
+
+type QuotaExceededError struct {
+	Scope string
+	Limit string
+	Quota StorageQuota
+	Usage StorageUsage
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s %s quota exceeded", e.Scope, e.Limit)
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
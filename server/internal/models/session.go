@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+type Session struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	JTI        string     `json:"-" db:"jti"`
+	DeviceName string     `json:"device_name" db:"device_name"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	IPAddress  string     `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	RevokedAt  *time.Time `json:"-" db:"revoked_at"`
+	Current    bool       `json:"current"`
+}
+
+type DeviceInfo struct {
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+}
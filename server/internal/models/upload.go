@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Upload is a resumable (tus) upload in progress. FileID is set once all
+// bytes were received and the blob was moved to file storage.
+type Upload struct {
+	ID          string    `json:"id" db:"id"`
+	UserID      int       `json:"user_id" db:"user_id"`
+	ChatID      int       `json:"chat_id" db:"chat_id"`
+	FileName    string    `json:"file_name" db:"file_name"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	MediaType   string    `json:"media_type" db:"media_type"`
+	Length      int64     `json:"length" db:"length"`
+	Offset      int64     `json:"offset" db:"upload_offset"`
+	FileID      *int      `json:"file_id,omitempty" db:"file_id"`
+	ThumbnailID *int      `json:"thumbnail_file_id,omitempty" db:"thumbnail_file_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
+}
+
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
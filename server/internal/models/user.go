@@ -16,11 +16,22 @@ type User struct {
 }
 
 type RefreshToken struct {
-	ID        int       `json:"id" db:"id"`
-	UserID    int       `json:"user_id" db:"user_id"`
-	Token     string    `json:"token" db:"token"`
-	Expiry    int64     `json:"expiry" db:"expiry"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	Token     string     `json:"token" db:"token"`
+	Expiry    int64      `json:"expiry" db:"expiry"`
+	FamilyID  string     `json:"family_id" db:"family_id"`
+	SessionID int        `json:"session_id" db:"session_id"`
+	UsedAt    *time.Time `json:"used_at" db:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	SessionID    int    `json:"session_id"`
 }
 
 type EncryptedKey struct {
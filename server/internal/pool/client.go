@@ -0,0 +1,237 @@
+package pool
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"SecureMessenger/server/internal/config"
+
+	"github.com/gorilla/websocket"
+)
+
+type OverflowPolicy string
+
+const (
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+var (
+	sendQueueSize  = config.GetInt("WS_SEND_QUEUE_SIZE", 256)
+	overflowPolicy = OverflowPolicy(config.GetString("WS_OVERFLOW_POLICY", string(OverflowDropOldest)))
+	writeTimeout   = config.GetDuration("WS_WRITE_TIMEOUT", 10*time.Second)
+	pongWait       = config.GetDuration("WS_PONG_WAIT", 60*time.Second)
+	pingPeriod     = config.GetDuration("WS_PING_PERIOD", 30*time.Second)
+	maxMessageSize = config.GetInt64("WS_MAX_MESSAGE_SIZE", 512*1024)
+)
+
+func init() {
+	switch overflowPolicy {
+	case OverflowDropOldest, OverflowDisconnect:
+	default:
+		log.Fatalf("Unknown WS_OVERFLOW_POLICY %q, must be %q or %q", overflowPolicy, OverflowDropOldest, OverflowDisconnect)
+	}
+}
+
+type Client struct {
+	ID        string
+	UserID    int
+	SessionID int
+	Conn      *websocket.Conn
+	Ctx       context.Context
+	Cancel    context.CancelFunc
+
+	send      chan []byte
+	closeOnce sync.Once
+
+	// While a resume is replaying missed events, live events are held back
+	// so the client never sees cursors out of order.
+	replayMu  sync.Mutex
+	replaying bool
+	held      []heldEvent
+}
+
+type heldEvent struct {
+	msg    []byte
+	cursor int64
+}
+
+func newClient(userID, sessionID int, conn *websocket.Conn) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &Client{
+		ID:        newConnectionID(),
+		UserID:    userID,
+		SessionID: sessionID,
+		Conn:      conn,
+		Ctx:       ctx,
+		Cancel:    cancel,
+		send:      make(chan []byte, sendQueueSize),
+	}
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	metrics.Add(metricConnectionsActive, 1)
+	go client.writePump()
+	return client
+}
+
+// enqueue never blocks; it returns false when the client has to be
+// disconnected because it is closed or cannot keep up.
+func (c *Client) enqueue(msg []byte) bool {
+	for {
+		if c.Ctx.Err() != nil {
+			return false
+		}
+
+		select {
+		case c.send <- msg:
+			metrics.Add(metricEventsQueued, 1)
+			return true
+		default:
+		}
+
+		if overflowPolicy == OverflowDisconnect {
+			log.Printf("Send queue of connection %s (user %d) is full, disconnecting slow consumer", c.ID, c.UserID)
+			metrics.Add(metricSlowConsumersClosed, 1)
+			return false
+		}
+
+		select {
+		case <-c.send:
+			metrics.Add(metricEventsDropped, 1)
+			log.Printf("Send queue of connection %s (user %d) is full, dropped oldest event", c.ID, c.UserID)
+		default:
+		}
+	}
+}
+
+func (c *Client) Send(eventType string, data interface{}) bool {
+	return c.SendWithCursor(eventType, data, 0)
+}
+
+func (c *Client) SendWithCursor(eventType string, data interface{}, cursor int64) bool {
+	msg, err := encodeEvent(eventType, data, cursor)
+	if err != nil {
+		return false
+	}
+
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+
+	if c.replaying {
+		return c.hold(heldEvent{msg: msg, cursor: cursor})
+	}
+
+	if !c.enqueue(msg) {
+		c.Close()
+		return false
+	}
+	return true
+}
+
+// hold buffers a live event during a replay, applying the overflow policy
+// once as many events are held as the send queue could take.
+func (c *Client) hold(event heldEvent) bool {
+	if len(c.held) >= sendQueueSize {
+		if overflowPolicy == OverflowDisconnect {
+			log.Printf("Too many live events held during replay on connection %s (user %d), disconnecting slow consumer", c.ID, c.UserID)
+			metrics.Add(metricSlowConsumersClosed, 1)
+			c.Close()
+			return false
+		}
+		c.held = c.held[1:]
+		metrics.Add(metricEventsDropped, 1)
+		log.Printf("Too many live events held during replay on connection %s (user %d), dropped oldest event", c.ID, c.UserID)
+	}
+	c.held = append(c.held, event)
+	return true
+}
+
+// BeginReplay holds back live events until EndReplay is called.
+func (c *Client) BeginReplay() {
+	c.replayMu.Lock()
+	c.replaying = true
+	c.replayMu.Unlock()
+}
+
+// Replay queues a missed event, waiting for room in the send queue instead
+// of dropping anything. It returns false once the connection is closed.
+func (c *Client) Replay(eventType string, data interface{}, cursor int64) bool {
+	msg, err := encodeEvent(eventType, data, cursor)
+	if err != nil {
+		return false
+	}
+
+	select {
+	case c.send <- msg:
+		metrics.Add(metricEventsQueued, 1)
+		return true
+	case <-c.Ctx.Done():
+		return false
+	}
+}
+
+// EndReplay delivers the live events held during the replay, skipping the
+// ones the replay already sent up to cursor.
+func (c *Client) EndReplay(cursor int64) {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+
+	held := c.held
+	c.replaying = false
+	c.held = nil
+
+	for _, event := range held {
+		if event.cursor != 0 && event.cursor <= cursor {
+			continue
+		}
+		if !c.enqueue(event.msg) {
+			c.Close()
+			return
+		}
+	}
+}
+
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		c.Cancel()
+		c.Conn.Close()
+		metrics.Add(metricConnectionsActive, -1)
+	})
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+	}()
+
+	for {
+		select {
+		case <-c.Ctx.Done():
+			return
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("Error pinging connection %s (user %d): %v", c.ID, c.UserID, err)
+				metrics.Add(metricWriteErrors, 1)
+				return
+			}
+		case msg := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				log.Printf("Error writing to connection %s (user %d): %v", c.ID, c.UserID, err)
+				metrics.Add(metricWriteErrors, 1)
+				return
+			}
+			metrics.Add(metricEventsSent, 1)
+		}
+	}
+}
@@ -1,71 +1,103 @@
 package pool
 
 import (
+	"SecureMessenger/server/internal/models"
 	"SecureMessenger/server/internal/services"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type ClientPool interface {
-	AddClient(userID int, conn *websocket.Conn)
-	GetClient(userID int) *Client
-	RemoveClient(userID int)
+	AddClient(userID, sessionID int, conn *websocket.Conn) *Client
+	GetClients(userID int) []*Client
+	IsOnline(userID int) bool
+	RemoveClient(client *Client)
+	DisconnectSession(sessionID int)
 	BroadcastEvent(chatID int, eventType string, data interface{})
-}
-
-type Client struct {
-	UserID int
-	Conn   *websocket.Conn
-	Ctx    context.Context
-	Cancel context.CancelFunc
+	BroadcastEphemeral(chatID, senderID int, eventType string, data interface{})
+	SendToUser(userID int, eventType string, data interface{})
 }
 
 var chatService services.ChatService
+var eventService services.EventService
+var presenceService services.PresenceService
 
 func init() {
 	userService := services.NewUserService()
 	chatService = services.NewChatService(userService)
+	eventService = services.NewEventService()
+	presenceService = services.NewPresenceService()
 }
 
 type Pool struct {
 	mu      sync.Mutex
-	clients map[int]*Client
+	clients map[int]map[string]*Client
 }
 
 var GlobalPool ClientPool = &Pool{
-	clients: make(map[int]*Client),
+	clients: make(map[int]map[string]*Client),
+}
+
+func (p *Pool) AddClient(userID, sessionID int, conn *websocket.Conn) *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client := newClient(userID, sessionID, conn)
+	if p.clients[userID] == nil {
+		p.clients[userID] = make(map[string]*Client)
+		go p.broadcastPresence(userID, "online")
+	}
+	p.clients[userID][client.ID] = client
+
+	log.Printf("Client %d added to pool (connection %s, session %d, %d active)", userID, client.ID, sessionID, len(p.clients[userID]))
+	return client
 }
 
-func (p *Pool) AddClient(userID int, conn *websocket.Conn) {
+func (p *Pool) GetClients(userID int) []*Client {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	p.clients[userID] = &Client{
-		UserID: userID,
-		Conn:   conn,
-		Ctx:    ctx,
-		Cancel: cancel,
+	clients := make([]*Client, 0, len(p.clients[userID]))
+	for _, client := range p.clients[userID] {
+		clients = append(clients, client)
 	}
-	log.Printf("Client %d added to pool", userID)
+	return clients
+}
+
+func (p *Pool) IsOnline(userID int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.clients[userID]) > 0
 }
 
-func (p *Pool) GetClient(userID int) *Client {
+func (p *Pool) RemoveClient(client *Client) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	return p.clients[userID]
+	p.removeClientLocked(client)
 }
 
-func (p *Pool) RemoveClient(userID int) {
+func (p *Pool) DisconnectSession(sessionID int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	delete(p.clients, userID)
-	log.Printf("Client %d removed from pool", userID)
+	for _, connections := range p.clients {
+		for _, client := range connections {
+			if client.SessionID != sessionID {
+				continue
+			}
+			p.removeClientLocked(client)
+			log.Printf("Connection %s of user %d closed (session %d revoked)", client.ID, client.UserID, sessionID)
+		}
+	}
 }
 
 func (p *Pool) BroadcastEvent(chatID int, eventType string, data interface{}) {
@@ -75,25 +107,169 @@ func (p *Pool) BroadcastEvent(chatID int, eventType string, data interface{}) {
 		return
 	}
 
+	userIDs := make([]int, 0, len(participants))
+	for _, participant := range participants {
+		userIDs = append(userIDs, participant.ID)
+	}
+
+	p.deliver(userIDs, &chatID, eventType, data)
+}
+
+func (p *Pool) BroadcastEphemeral(chatID, senderID int, eventType string, data interface{}) {
+	participants, err := chatService.GetParticipantsByChatId(context.Background(), chatID)
+	if err != nil {
+		log.Printf("Error getting participants for chat %d: %v", chatID, err)
+		return
+	}
+
+	msg, err := encodeEvent(eventType, data, 0)
+	if err != nil {
+		return
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	for _, participant := range participants {
-		client := p.clients[participant.ID]
-		if client == nil {
+		if participant.ID == senderID {
+			continue
+		}
+		p.enqueueLocked(participant.ID, msg)
+	}
+}
+
+func (p *Pool) SendToUser(userID int, eventType string, data interface{}) {
+	p.deliver([]int{userID}, nil, eventType, data)
+}
+
+func (p *Pool) deliver(userIDs []int, chatID *int, eventType string, data interface{}) {
+	cursors, err := eventService.AppendEvent(context.Background(), userIDs, chatID, eventType, data)
+	if err != nil {
+		log.Printf("Error persisting %s event, delivering without cursor: %v", eventType, err)
+		cursors = map[int]int64{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, userID := range userIDs {
+		if len(p.clients[userID]) == 0 {
 			continue
 		}
 
-		err := client.Conn.WriteJSON(map[string]interface{}{
-			"event": eventType,
-			"data":  data,
-		})
+		msg, err := encodeEvent(eventType, data, cursors[userID])
 		if err != nil {
-			log.Printf("Error sending event to user %d: %v", participant.ID, err)
-			client.Conn.Close()
-			p.RemoveClient(participant.ID)
+			return
 		}
+		p.enqueueLocked(userID, msg)
+	}
+}
+
+func (p *Pool) enqueueLocked(userID int, msg []byte) {
+	for _, client := range p.clients[userID] {
+		if !client.enqueue(msg) {
+			p.removeClientLocked(client)
+			continue
+		}
+
+		log.Printf("queued event for user %d (connection %s)", userID, client.ID)
+	}
+}
+
+func (p *Pool) removeClientLocked(client *Client) {
+	connections := p.clients[client.UserID]
+	if connections[client.ID] != client {
+		return
+	}
+
+	client.Close()
+	delete(connections, client.ID)
+	log.Printf("Client %d removed from pool (connection %s)", client.UserID, client.ID)
+
+	if len(connections) == 0 {
+		delete(p.clients, client.UserID)
+		go p.broadcastPresence(client.UserID, "offline")
+	}
+}
+
+func (p *Pool) broadcastPresence(userID int, status string) {
+	peerIDs, err := chatService.GetChatPeerIds(context.Background(), userID)
+	if err != nil {
+		log.Printf("Error getting chat peers of user %d: %v", userID, err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"user_id": userID,
+		"status":  status,
+	}
+
+	// Peers share a chat with the user and so count as contacts. Users who
+	// hide their last seen time from everybody also hide their online status.
+	var visibility string
+	if status == "offline" {
+		var lastSeenAt time.Time
+		lastSeenAt, visibility, err = presenceService.UpdateLastSeen(context.Background(), userID)
+		if err != nil {
+			log.Printf("Error updating last seen of user %d: %v", userID, err)
+			return
+		}
+		data["last_seen_at"] = lastSeenAt
+	} else {
+		visibility, err = presenceService.GetLastSeenVisibility(context.Background(), userID)
+		if err != nil {
+			log.Printf("Error getting last seen visibility of user %d: %v", userID, err)
+			return
+		}
+	}
+	if visibility == models.LastSeenNobody {
+		return
+	}
+
+	msg, err := encodeEvent("presence", data, 0)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if status == "offline" && len(p.clients[userID]) > 0 {
+		log.Printf("User %d reconnected, skipping offline presence", userID)
+		return
+	}
+	if status == "online" && len(p.clients[userID]) == 0 {
+		log.Printf("User %d already disconnected, skipping online presence", userID)
+		return
+	}
+
+	for _, peerID := range peerIDs {
+		p.enqueueLocked(peerID, msg)
+	}
+	log.Printf("Presence of user %d (%s) sent to %d peers", userID, status, len(peerIDs))
+}
+
+func encodeEvent(eventType string, data interface{}, cursor int64) ([]byte, error) {
+	frame := map[string]interface{}{
+		"event": eventType,
+		"data":  data,
+	}
+	if cursor > 0 {
+		frame["cursor"] = cursor
+	}
+
+	msg, err := json.Marshal(frame)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return nil, err
+	}
+	return msg, nil
+}
 
-		log.Printf("sending event to user %d", participant.ID)
+func newConnectionID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("Error generating connection ID: %v", err)
 	}
+	return hex.EncodeToString(buf)
 }
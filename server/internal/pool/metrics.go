@@ -0,0 +1,14 @@
+package pool
+
+import "expvar"
+
+var metrics = expvar.NewMap("websocket")
+
+const (
+	metricConnectionsActive   = "connections_active"
+	metricEventsQueued        = "events_queued"
+	metricEventsSent          = "events_sent"
+	metricEventsDropped       = "events_dropped"
+	metricSlowConsumersClosed = "slow_consumers_disconnected"
+	metricWriteErrors         = "write_errors"
+)
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"SecureMessenger/server/internal/db"
+	"SecureMessenger/server/internal/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var JWTSecret = []byte("secret-key")
+
+type AuthService interface {
+	IssueTokens(ctx context.Context, user *models.User, device models.DeviceInfo) (*models.TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshToken string) (tokens *models.TokenPair, revokedSessionID int, err error)
+	RevokeRefreshToken(ctx context.Context, refreshToken string) (int, error)
+}
+
+type authService struct {
+	UserService    UserService
+	SessionService SessionService
+}
+
+func NewAuthService(userService UserService, sessionService SessionService) AuthService {
+	return &authService{
+		UserService:    userService,
+		SessionService: sessionService,
+	}
+}
+
+func (as *authService) IssueTokens(ctx context.Context, user *models.User, device models.DeviceInfo) (*models.TokenPair, error) {
+	session, err := as.SessionService.CreateSession(ctx, user.ID, device)
+	if err != nil {
+		return nil, err
+	}
+
+	familyID, err := generateRandomToken(16)
+	if err != nil {
+		log.Printf("Error generating token family for user %d: %v", user.ID, err)
+		return nil, err
+	}
+
+	refreshToken, err := as.insertRefreshToken(ctx, db.Pool, user.ID, session.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := generateAccessToken(user.ID, user.Username, session.JTI)
+	if err != nil {
+		log.Printf("Error creating access token for user %d: %v", user.ID, err)
+		return nil, err
+	}
+
+	log.Printf("Issued new token family for user %d in session %d", user.ID, session.ID)
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(AccessTokenTTL.Seconds()),
+		SessionID:    session.ID,
+	}, nil
+}
+
+func (as *authService) RefreshTokens(ctx context.Context, refreshToken string) (*models.TokenPair, int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("rt.id", "rt.user_id", "rt.expiry", "rt.family_id", "rt.session_id", "rt.used_at", "rt.revoked_at", "s.jti").
+		From("refresh_tokens rt").
+		Join("sessions s ON s.id = rt.session_id").
+		Where(squirrel.Eq{"rt.token": hashToken(refreshToken)}).
+		Suffix("FOR UPDATE OF rt")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, 0, err
+	}
+
+	var stored models.RefreshToken
+	var jti string
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(
+		&stored.ID, &stored.UserID, &stored.Expiry, &stored.FamilyID, &stored.SessionID, &stored.UsedAt, &stored.RevokedAt, &jti,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Println("Refresh token not found")
+			return nil, 0, models.ErrInvalidRefreshToken
+		}
+		log.Printf("Error fetching refresh token: %v", err)
+		return nil, 0, err
+	}
+
+	if stored.RevokedAt != nil {
+		log.Printf("Refresh token %d of user %d is revoked", stored.ID, stored.UserID)
+		return nil, 0, models.ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil {
+		log.Printf("Refresh token %d of user %d was already used, revoking session %d", stored.ID, stored.UserID, stored.SessionID)
+		tx.Rollback(ctx)
+		if _, err := revokeSessions(ctx, squirrel.Eq{"id": stored.SessionID}); err != nil {
+			return nil, 0, err
+		}
+		return nil, stored.SessionID, models.ErrRefreshTokenReused
+	}
+
+	if time.Now().Unix() > stored.Expiry {
+		log.Printf("Refresh token %d of user %d has expired", stored.ID, stored.UserID)
+		return nil, 0, models.ErrInvalidRefreshToken
+	}
+
+	updateQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("refresh_tokens").
+		Set("used_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": stored.ID})
+
+	sqlStr, args, err = updateQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, 0, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	if _, err := tx.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error marking refresh token %d as used: %v", stored.ID, err)
+		return nil, 0, err
+	}
+
+	user, err := as.UserService.GetUserById(ctx, stored.UserID)
+	if err != nil {
+		log.Printf("Error getting user by ID %d: %v", stored.UserID, err)
+		return nil, 0, err
+	}
+
+	newRefreshToken, err := as.insertRefreshToken(ctx, tx, user.ID, stored.SessionID, stored.FamilyID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	accessToken, err := generateAccessToken(user.ID, user.Username, jti)
+	if err != nil {
+		log.Printf("Error creating access token for user %d: %v", user.ID, err)
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, 0, err
+	}
+
+	log.Printf("Rotated refresh token for user %d in session %d", user.ID, stored.SessionID)
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    int64(AccessTokenTTL.Seconds()),
+		SessionID:    stored.SessionID,
+	}, 0, nil
+}
+
+func (as *authService) RevokeRefreshToken(ctx context.Context, refreshToken string) (int, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("session_id").
+		From("refresh_tokens").
+		Where(squirrel.Eq{"token": hashToken(refreshToken)})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return 0, err
+	}
+
+	var sessionID int
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&sessionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, models.ErrInvalidRefreshToken
+		}
+		log.Printf("Error fetching refresh token: %v", err)
+		return 0, err
+	}
+
+	if _, err := revokeSessions(ctx, squirrel.Eq{"id": sessionID}); err != nil {
+		return 0, err
+	}
+
+	log.Printf("Revoked session %d", sessionID)
+	return sessionID, nil
+}
+
+func (as *authService) insertRefreshToken(ctx context.Context, q db.Querier, userID, sessionID int, familyID string) (string, error) {
+	refreshToken, err := generateRandomToken(32)
+	if err != nil {
+		log.Printf("Error generating refresh token for user %d: %v", userID, err)
+		return "", err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("refresh_tokens").
+		Columns("user_id", "session_id", "token", "expiry", "family_id").
+		Values(userID, sessionID, hashToken(refreshToken), time.Now().Add(RefreshTokenTTL).Unix(), familyID)
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return "", err
+	}
+
+	if _, err := q.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error saving refresh token for user %d: %v", userID, err)
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+func revokeTokens(ctx context.Context, q db.Querier, where squirrel.Eq) error {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("refresh_tokens").
+		Set("revoked_at", squirrel.Expr("NOW()")).
+		Where(where).
+		Where(squirrel.Eq{"revoked_at": nil})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	if _, err := q.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error revoking refresh tokens: %v", err)
+		return err
+	}
+	return nil
+}
+
+func generateAccessToken(userID int, username, jti string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti":      jti,
+		"user_id":  userID,
+		"username": username,
+		"iat":      now.Unix(),
+		"exp":      now.Add(AccessTokenTTL).Unix(),
+	})
+	return token.SignedString(JWTSecret)
+}
+
+func generateRandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"SecureMessenger/server/internal/db"
+	"SecureMessenger/server/internal/models"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// connectTestDB points db.Pool at the migrated database named by
+// TEST_DATABASE_DSN and skips the test when there is none.
+func connectTestDB(t *testing.T) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	previous := db.Pool
+	db.Pool = pool
+	t.Cleanup(func() {
+		db.Pool = previous
+		pool.Close()
+	})
+}
+
+func createTestUser(t *testing.T, userService UserService, username string) *models.User {
+	t.Helper()
+	ctx := context.Background()
+
+	userID, err := userService.CreateUser(ctx, &models.User{
+		Username:     username,
+		Email:        username + "@example.com",
+		PasswordHash: "password",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1", userID)
+		db.Pool.Exec(ctx, "DELETE FROM users WHERE id = $1", userID)
+	})
+
+	user, err := userService.GetUserById(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserById: %v", err)
+	}
+	return user
+}
+
+// issueAndRotate signs a new user in and refreshes their tokens once.
+func issueAndRotate(t *testing.T) (AuthService, *models.TokenPair, *models.TokenPair) {
+	t.Helper()
+	connectTestDB(t)
+	ctx := context.Background()
+
+	suffix, err := generateRandomToken(6)
+	if err != nil {
+		t.Fatalf("generateRandomToken: %v", err)
+	}
+
+	userService := NewUserService()
+	authService := NewAuthService(userService, NewSessionService())
+	user := createTestUser(t, userService, "rotation_"+suffix)
+
+	issued, err := authService.IssueTokens(ctx, user, models.DeviceInfo{DeviceName: "test"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+
+	rotated, _, err := authService.RefreshTokens(ctx, issued.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if rotated.RefreshToken == issued.RefreshToken {
+		t.Fatal("RefreshTokens returned the same refresh token")
+	}
+	return authService, issued, rotated
+}
+
+func TestRefreshTokensRejectsRotatedToken(t *testing.T) {
+	authService, issued, _ := issueAndRotate(t)
+
+	_, revokedSessionID, err := authService.RefreshTokens(context.Background(), issued.RefreshToken)
+	if !errors.Is(err, models.ErrRefreshTokenReused) {
+		t.Fatalf("RefreshTokens with rotated token: err = %v, want %v", err, models.ErrRefreshTokenReused)
+	}
+	if revokedSessionID != issued.SessionID {
+		t.Errorf("revoked session = %d, want %d", revokedSessionID, issued.SessionID)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	authService, issued, rotated := issueAndRotate(t)
+	ctx := context.Background()
+
+	if _, _, err := authService.RefreshTokens(ctx, issued.RefreshToken); !errors.Is(err, models.ErrRefreshTokenReused) {
+		t.Fatalf("RefreshTokens with rotated token: err = %v, want %v", err, models.ErrRefreshTokenReused)
+	}
+
+	var active int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM refresh_tokens
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token = $1)
+		AND revoked_at IS NULL`, hashToken(issued.RefreshToken)).Scan(&active)
+	if err != nil {
+		t.Fatalf("counting active tokens: %v", err)
+	}
+	if active != 0 {
+		t.Errorf("%d tokens of the family are still active, want 0", active)
+	}
+
+	// The token that replaced the reused one is gone as well.
+	if _, _, err := authService.RefreshTokens(ctx, rotated.RefreshToken); !errors.Is(err, models.ErrInvalidRefreshToken) {
+		t.Errorf("RefreshTokens with successor token: err = %v, want %v", err, models.ErrInvalidRefreshToken)
+	}
+}
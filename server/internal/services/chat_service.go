@@ -13,6 +13,7 @@ import (
 	"github.com/Masterminds/squirrel"
 	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx"
+	pgxv4 "github.com/jackc/pgx/v4"
 )
 
 type ChatService interface {
@@ -20,14 +21,32 @@ type ChatService interface {
 	AddParticipants(ctx context.Context, chatID int, userIDs []int, encryptedKeys map[int]string) error
 	GetChatsByUserId(ctx context.Context, userID int) ([]models.ChatWithLastMessage, error)
 	GetChatById(ctx context.Context, chatID, userID int) (*models.Chat, error)
+	GetChatType(ctx context.Context, chatID int) (string, error)
 	IsUserInChat(ctx context.Context, chatID, userID int) (bool, error)
 	IsChatCreator(ctx context.Context, chatID, userID int) (bool, error)
 	GetParticipantsByChatId(ctx context.Context, chatID int) ([]models.User, error)
-	SaveMessage(ctx context.Context, chatID, senderID int, username, content string) (int, time.Time, error)
-	GetMessagesByChatId(ctx context.Context, chatID, offset, limit int) ([]models.Message, error)
+	GetChatPeerIds(ctx context.Context, userID int) ([]int, error)
+	SaveMessage(ctx context.Context, msg models.Message) (*models.Message, bool, error)
+	SaveMessages(ctx context.Context, msgs []models.Message, quotas []models.QuotaCheck) ([]*models.Message, []bool, error)
+	GetForwardSource(ctx context.Context, chatID, messageID int, hideSender bool) (*models.ForwardRef, error)
+	GetMessagesByChatId(ctx context.Context, chatID int, query models.MessageQuery) (*models.MessagePage, error)
+	EditMessage(ctx context.Context, chatID, messageID, editorID int, content string, window time.Duration) (*models.Message, error)
+	GetMessageEdits(ctx context.Context, chatID, messageID int) ([]models.MessageEdit, error)
+	HideMessage(ctx context.Context, chatID, messageID, userID int) error
+	AddReaction(ctx context.Context, chatID, messageID, userID int, emoji string) (bool, error)
+	RemoveReaction(ctx context.Context, chatID, messageID, userID int, emoji string) (bool, error)
+	GetReactions(ctx context.Context, messageID int) ([]models.Reaction, error)
+	PinMessage(ctx context.Context, chatID, messageID, userID, limit int) (*models.PinnedMessage, bool, error)
+	UnpinMessage(ctx context.Context, chatID, messageID int) (bool, error)
+	GetPinnedMessages(ctx context.Context, chatID int) ([]models.PinnedMessage, error)
+	GetThread(ctx context.Context, chatID, rootID, viewerID int) (*models.Thread, error)
+	MarkThreadAsRead(ctx context.Context, chatID, rootID, userID, lastReadMessageID int) (int64, error)
+	DeleteMessageForEveryone(ctx context.Context, chatID, messageID, userID int, window time.Duration) (*models.Message, error)
 	IsUserParticipant(ctx context.Context, chatID, userID int) (bool, error)
 	MarkMessagesAsRead(ctx context.Context, chatID, recipientID, lastReadMessageID int) ([]int, []int, error)
+	MarkMessagesAsDelivered(ctx context.Context, chatID, recipientID, lastDeliveredMessageID int) ([]int, []int, error)
 	GetUnreadMessagesCount(ctx context.Context, chatID, userID int) (int, error)
+	GetMessageReaders(ctx context.Context, chatID, messageID int) ([]models.MessageRead, error)
 	GetParticipants(ctx context.Context, chatID int) ([]models.User, error)
 	CheckExistingPrivateChat(ctx context.Context, user1ID, user2ID int) (int, error)
 	RemoveParticipant(ctx context.Context, chatID, userID int) error
@@ -78,6 +97,12 @@ func (cs *chatService) CreateChat(ctx context.Context, creatorID, recipientID in
 	return chatID, nil
 }
 
+// chatHeadSeq starts a new participant's read and delivery pointers at the
+// chat's latest message, so history from before they joined is not unread.
+func chatHeadSeq(chatID int) squirrel.Sqlizer {
+	return squirrel.Expr("(SELECT last_message_seq FROM chats WHERE id = ?)", chatID)
+}
+
 func (cs *chatService) AddParticipants(ctx context.Context, chatID int, userIDs []int, encryptedKeys map[int]string) error {
 	for _, userID := range userIDs {
 		encryptedKey := encryptedKeys[userID]
@@ -98,8 +123,8 @@ func (cs *chatService) AddParticipants(ctx context.Context, chatID int, userIDs
 
 		query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
 			Insert("chat_participants").
-			Columns("chat_id", "user_id", "encrypted_chat_key").
-			Values(chatID, userID, encryptedKey)
+			Columns("chat_id", "user_id", "encrypted_chat_key", "last_read_seq", "last_delivered_seq").
+			Values(chatID, userID, encryptedKey, chatHeadSeq(chatID), chatHeadSeq(chatID))
 		sqlStr, args, err := query.ToSql()
 		if err != nil {
 			log.Printf("Failed to build SQL query: %v", err)
@@ -127,8 +152,12 @@ func (cs *chatService) GetChatsByUserId(ctx context.Context, userID int) ([]mode
 		).
 		From("chats").
 		Join("chat_participants cp ON chats.id = cp.chat_id AND cp.user_id = ?", userID).
-		LeftJoin("messages ON chats.id = messages.chat_id AND messages.sent_at = (" +
-			"SELECT MAX(sent_at) FROM messages WHERE messages.chat_id = chats.id)").
+		LeftJoin(`LATERAL (
+			SELECT content, sent_at FROM messages
+			WHERE messages.chat_id = chats.id AND messages.thread_root_id IS NULL
+			ORDER BY messages.seq DESC
+			LIMIT 1
+		) messages ON TRUE`).
 		Where(squirrel.Eq{"cp.user_id": userID}).
 		OrderBy("messages.sent_at DESC NULLS LAST")
 
@@ -250,6 +279,32 @@ func (cs *chatService) GetChatById(ctx context.Context, chatID, userID int) (*mo
 	return &chat, nil
 }
 
+func (cs *chatService) GetChatType(ctx context.Context, chatID int) (string, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("type").
+		From("chats").
+		Where(squirrel.Eq{"id": chatID})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return "", err
+	}
+
+	var chatType string
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&chatType)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Chat %d not found", chatID)
+			return "", models.ErrChatNotFound
+		}
+		log.Printf("Error getting type of chat %d: %v", chatID, err)
+		return "", err
+	}
+
+	return chatType, nil
+}
+
 func (cs *chatService) IsUserInChat(ctx context.Context, chatID, userID int) (bool, error) {
 	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
 		Select("COUNT(*)").
@@ -294,7 +349,7 @@ func (cs *chatService) IsChatCreator(ctx context.Context, chatID, userID int) (b
 	var createdBy int
 	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&createdBy)
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, pgxv4.ErrNoRows) {
 			log.Printf("Chat %d not found", chatID)
 			return false, models.ErrChatNotFound
 		}
@@ -347,210 +402,1632 @@ func (cs *chatService) GetParticipantsByChatId(ctx context.Context, chatID int)
 	return participants, nil
 }
 
-func (cs *chatService) SaveMessage(ctx context.Context, chatID, senderID int, username, content string) (int, time.Time, error) {
+func (cs *chatService) GetChatPeerIds(ctx context.Context, userID int) ([]int, error) {
 	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
-		Insert("messages").
-		Columns("chat_id", "sender_id", "username", "content", "encrypted", "sent_at").
-		Values(chatID, senderID, username, content, true, squirrel.Expr("NOW()")).
-		Suffix("RETURNING id, sent_at")
+		Select("DISTINCT peer.user_id").
+		From("chat_participants own").
+		Join("chat_participants peer ON peer.chat_id = own.chat_id").
+		Where(squirrel.And{
+			squirrel.Eq{"own.user_id": userID},
+			squirrel.NotEq{"peer.user_id": userID},
+		})
 
 	sqlStr, args, err := query.ToSql()
 	if err != nil {
 		log.Printf("Failed to build SQL query: %v", err)
-		return 0, time.Time{}, err
+		return nil, err
 	}
 
 	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
 
-	var messageID int
-	var sentAt time.Time
-	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&messageID, &sentAt)
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
 	if err != nil {
-		log.Printf("Error saving message: %v", err)
-		return 0, time.Time{}, err
+		log.Printf("Error getting chat peers of user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var peerIDs []int
+	for rows.Next() {
+		var peerID int
+		if err := rows.Scan(&peerID); err != nil {
+			log.Printf("Error scanning peer ID: %v", err)
+			continue
+		}
+		peerIDs = append(peerIDs, peerID)
 	}
 
-	log.Printf("Message saved: Chat ID %d, Sender ID %d (%s), Message ID: %d, Sent At: %v", chatID, senderID, username, messageID, sentAt)
-	return messageID, sentAt, nil
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over chat peers: %v", err)
+		return nil, err
+	}
+
+	return peerIDs, nil
 }
 
-func (cs *chatService) GetMessagesByChatId(ctx context.Context, chatID, offset, limit int) ([]models.Message, error) {
-	queryBuilder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
-		Select("id", "chat_id", "sender_id", "username", "content", "sent_at", "read_at").
-		From("messages").
-		Where(squirrel.Eq{"chat_id": chatID}).
-		OrderBy("sent_at DESC").
-		Limit(uint64(limit)).
-		Offset(uint64(offset))
+func (cs *chatService) SaveMessage(ctx context.Context, msg models.Message) (*models.Message, bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
 
-	sqlQuery, args, err := queryBuilder.ToSql()
+	saved, created, err := cs.saveMessage(ctx, tx, msg, nil)
 	if err != nil {
-		log.Printf("Error building SQL query: %v", err)
-		return nil, errors.New("failed to build query")
+		return nil, false, err
 	}
 
-	log.Printf("Executing SQL: %s, Args: %v", sqlQuery, args)
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, false, err
+	}
 
-	rows, err := db.Pool.Query(ctx, sqlQuery, args...)
+	if created {
+		log.Printf("Message saved: Chat ID %d, Seq %d, Sender ID %d (%s), Message ID: %d, Sent At: %v", saved.ChatID, saved.Seq, saved.SenderID, saved.Username, saved.ID, saved.SentAt)
+	}
+	return saved, created, nil
+}
+
+// SaveMessages saves a batch of messages in one transaction, so either all
+// of them are stored or none is. Files copied from forwarded messages are
+// checked against quotas.
+func (cs *chatService) SaveMessages(ctx context.Context, msgs []models.Message, quotas []models.QuotaCheck) ([]*models.Message, []bool, error) {
+	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
-		log.Printf("Error executing query for chat %d: %v", chatID, err)
-		return nil, err
+		log.Printf("Error starting transaction: %v", err)
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	saved := make([]*models.Message, 0, len(msgs))
+	created := make([]bool, 0, len(msgs))
+	for _, msg := range msgs {
+		message, isNew, err := cs.saveMessage(ctx, tx, msg, quotas)
+		if err != nil {
+			return nil, nil, err
+		}
+		saved = append(saved, message)
+		created = append(created, isNew)
 	}
-	defer rows.Close()
 
-	var messages []models.Message
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, nil, err
+	}
 
-	for rows.Next() {
-		var msg models.Message
-		var readAt pgtype.Timestamptz
+	log.Printf("Saved %d messages in one batch", len(saved))
+	return saved, created, nil
+}
+
+// saveMessage stores msg inside a savepoint of tx. When the client message ID
+// was already used, only the savepoint is rolled back and the existing message
+// is returned, so the rest of the transaction stays usable.
+func (cs *chatService) saveMessage(ctx context.Context, outer pgxv4.Tx, msg models.Message, quotas []models.QuotaCheck) (*models.Message, bool, error) {
+	tx, err := outer.Begin(ctx)
+	if err != nil {
+		log.Printf("Error creating savepoint: %v", err)
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
 
-		err := rows.Scan(&msg.ID, &msg.ChatID, &msg.SenderID, &msg.Username, &msg.Content, &msg.SentAt, &readAt)
+	if msg.ReplyTo != nil {
+		msg.ReplyTo, err = getMessageRef(ctx, tx, msg.ChatID, msg.ReplyTo.ID)
 		if err != nil {
-			log.Printf("Error scanning row: %v", err)
-			return nil, err
+			return nil, false, err
 		}
+	}
 
-		if readAt.Status == pgtype.Present {
-			msg.ReadAt = &readAt.Time
-		} else {
-			msg.ReadAt = nil
+	if msg.ThreadRootID != nil {
+		rootQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+			Update("messages").
+			Set("thread_reply_count", squirrel.Expr("thread_reply_count + 1")).
+			Set("thread_last_reply_at", squirrel.Expr("NOW()")).
+			Where(squirrel.Eq{
+				"id":             *msg.ThreadRootID,
+				"chat_id":        msg.ChatID,
+				"thread_root_id": nil,
+				"deleted_at":     nil,
+			})
+
+		sqlStr, args, err := rootQuery.ToSql()
+		if err != nil {
+			log.Printf("Failed to build SQL query: %v", err)
+			return nil, false, err
 		}
 
-		messages = append(messages, msg)
+		log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+		result, err := tx.Exec(ctx, sqlStr, args...)
+		if err != nil {
+			log.Printf("Error updating thread root %d: %v", *msg.ThreadRootID, err)
+			return nil, false, err
+		}
+		if result.RowsAffected() == 0 {
+			log.Printf("Thread root %d not found in chat %d", *msg.ThreadRootID, msg.ChatID)
+			return nil, false, models.ErrMessageNotFound
+		}
 	}
 
-	if rows.Err() != nil {
-		log.Printf("Error after iterating rows: %v", rows.Err())
-		return nil, rows.Err()
+	seqQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("chats").
+		Set("last_message_seq", squirrel.Expr("last_message_seq + 1")).
+		Where(squirrel.Eq{"id": msg.ChatID}).
+		Suffix("RETURNING last_message_seq")
+
+	sqlStr, args, err := seqQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, false, err
 	}
 
-	log.Printf("Fetched %d messages for chat %d", len(messages), chatID)
-	return messages, nil
-}
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
 
-func (cs *chatService) IsUserParticipant(ctx context.Context, chatID, userID int) (bool, error) {
-	query := `
-        SELECT EXISTS (
-            SELECT 1
-            FROM chat_participants
-            WHERE chat_id = $1 AND user_id = $2
-        )
-    `
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(&msg.Seq)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Chat %d not found", msg.ChatID)
+			return nil, false, models.ErrChatNotFound
+		}
+		log.Printf("Error allocating sequence number in chat %d: %v", msg.ChatID, err)
+		return nil, false, err
+	}
 
-	var exists bool
-	err := db.Pool.QueryRow(ctx, query, chatID, userID).Scan(&exists)
+	columns := []string{"chat_id", "seq", "sender_id", "username", "content", "encrypted", "sent_at", "client_message_id", "reply_to_message_id", "thread_root_id"}
+	values := []interface{}{msg.ChatID, msg.Seq, msg.SenderID, msg.Username, msg.Content, true, squirrel.Expr("NOW()"), msg.ClientMessageID, replyToID(msg.ReplyTo), msg.ThreadRootID}
+	if msg.ForwardedFrom != nil {
+		columns = append(columns, "is_forwarded", "forwarded_from_message_id", "forwarded_from_chat_id", "forwarded_from_sender_id", "forwarded_from_username")
+		values = append(values, true, msg.ForwardedFrom.MessageID, msg.ForwardedFrom.ChatID, msg.ForwardedFrom.SenderID, nullIfEmpty(msg.ForwardedFrom.Username))
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("messages").
+		Columns(columns...).
+		Values(values...).
+		Suffix("ON CONFLICT (sender_id, client_message_id) DO NOTHING RETURNING id, sent_at")
+
+	sqlStr, args, err = query.ToSql()
 	if err != nil {
-		log.Printf("Error checking if user %d is a participant of chat %d: %v", userID, chatID, err)
-		return false, err
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, false, err
 	}
 
-	return exists, nil
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(&msg.ID, &msg.SentAt)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) && msg.ClientMessageID != nil {
+			log.Printf("Message with client ID %s from sender %d already exists", *msg.ClientMessageID, msg.SenderID)
+			tx.Rollback(ctx)
+			existing, err := cs.getMessageByClientId(ctx, outer, msg.SenderID, *msg.ClientMessageID)
+			if err != nil {
+				return nil, false, err
+			}
+			return existing, false, nil
+		}
+		log.Printf("Error saving message: %v", err)
+		return nil, false, err
+	}
+
+	if msg.ThreadRootID != nil {
+		if err := advanceThreadPointer(ctx, tx, *msg.ThreadRootID, msg.SenderID, msg.Seq); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// A forward references the files of its source message instead of fresh
+	// uploads.
+	if len(msg.Files) > 0 && msg.ForwardedFrom != nil {
+		msg.Files, err = copyForwardedFiles(ctx, tx, &msg, msg.Files, quotas)
+		if err != nil {
+			return nil, false, err
+		}
+	} else if len(msg.Files) > 0 {
+		fileIDs := make([]int, 0, len(msg.Files))
+		for _, file := range msg.Files {
+			fileIDs = append(fileIDs, file.ID)
+		}
+		msg.Files, err = attachFiles(ctx, tx, &msg, fileIDs)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error releasing savepoint: %v", err)
+		return nil, false, err
+	}
+
+	msg.Encrypted = true
+	return &msg, true, nil
 }
 
-func (cs *chatService) MarkMessagesAsRead(ctx context.Context, chatID, recipientID, lastReadMessageID int) ([]int, []int, error) {
+func (cs *chatService) getMessageByClientId(ctx context.Context, q db.Querier, senderID int, clientMessageID string) (*models.Message, error) {
 	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
-		Select("id", "sender_id").
-		From("messages").
-		Where(squirrel.And{
-			squirrel.Eq{"chat_id": chatID},
-			squirrel.LtOrEq{"id": lastReadMessageID},
-			squirrel.Eq{"read_at": nil},
-			squirrel.NotEq{"sender_id": recipientID},
+		Select("m.id", "m.chat_id", "m.seq", "m.sender_id", "m.username", "m.content", "m.encrypted", "m.sent_at", "m.client_message_id::text", "m.thread_root_id",
+			"r.id", "r.sender_id", "r.username", "r.content", "r.deleted_at IS NOT NULL",
+			"m.is_forwarded", "m.forwarded_from_message_id", "m.forwarded_from_chat_id", "m.forwarded_from_sender_id", "m.forwarded_from_username").
+		From("messages m").
+		LeftJoin("messages r ON r.id = m.reply_to_message_id").
+		Where(squirrel.Eq{
+			"m.sender_id":         senderID,
+			"m.client_message_id": clientMessageID,
 		})
 
 	sqlStr, args, err := query.ToSql()
 	if err != nil {
 		log.Printf("Failed to build SQL query: %v", err)
-		return nil, nil, err
+		return nil, err
 	}
 
 	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
 
-	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	var msg models.Message
+	var reply nullableMessageRef
+	var forward nullableForwardRef
+	err = q.QueryRow(ctx, sqlStr, args...).Scan(
+		&msg.ID, &msg.ChatID, &msg.Seq, &msg.SenderID, &msg.Username, &msg.Content, &msg.Encrypted, &msg.SentAt, &msg.ClientMessageID, &msg.ThreadRootID,
+		&reply.ID, &reply.SenderID, &reply.Username, &reply.Content, &reply.Deleted,
+		&forward.Forwarded, &forward.MessageID, &forward.ChatID, &forward.SenderID, &forward.Username,
+	)
 	if err != nil {
-		log.Printf("Error fetching unread messages for chat %d and recipient %d: %v", chatID, recipientID, err)
-		return nil, nil, err
+		log.Printf("Error getting message by client ID %s: %v", clientMessageID, err)
+		return nil, err
 	}
-	defer rows.Close()
+	msg.ReplyTo = reply.ref()
+	msg.ForwardedFrom = forward.ref()
 
-	var messageIDs []int
-	var senderIDsMap = make(map[int]struct{})
-	for rows.Next() {
-		var id, senderID int
-		err := rows.Scan(&id, &senderID)
-		if err != nil {
-			log.Printf("Error scanning message ID or sender ID: %v", err)
-			continue
-		}
-		messageIDs = append(messageIDs, id)
-		senderIDsMap[senderID] = struct{}{}
+	messages := []models.Message{msg}
+	if err := setMessageFiles(ctx, q, messages); err != nil {
+		return nil, err
 	}
 
-	if len(messageIDs) == 0 {
-		log.Printf("No unread messages found for chat %d and recipient %d", chatID, recipientID)
-		return nil, nil, nil
+	return &messages[0], nil
+}
+
+// nullableMessageRef scans the columns of an optional LEFT JOINed message.
+type nullableMessageRef struct {
+	ID       *int
+	SenderID *int
+	Username *string
+	Content  *string
+	Deleted  *bool
+}
+
+func (r nullableMessageRef) ref() *models.MessageRef {
+	if r.ID == nil {
+		return nil
 	}
 
-	var senderIDs []int
-	for senderID := range senderIDsMap {
-		senderIDs = append(senderIDs, senderID)
+	ref := &models.MessageRef{ID: *r.ID}
+	if r.SenderID != nil {
+		ref.SenderID = *r.SenderID
+	}
+	if r.Username != nil {
+		ref.Username = *r.Username
+	}
+	if r.Deleted != nil {
+		ref.Deleted = *r.Deleted
+	}
+	if r.Content != nil && !ref.Deleted {
+		ref.Content = *r.Content
 	}
+	return ref
+}
 
-	updateQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
-		Update("messages").
-		Set("read_at", squirrel.Expr("NOW()")).
-		Where(squirrel.And{
-			squirrel.Eq{"chat_id": chatID},
-			squirrel.LtOrEq{"id": lastReadMessageID},
-			squirrel.Eq{"read_at": nil},
-			squirrel.NotEq{"sender_id": recipientID},
+// nullableForwardRef scans the forwarded_from columns of a message.
+type nullableForwardRef struct {
+	Forwarded bool
+	MessageID *int
+	ChatID    *int
+	SenderID  *int
+	Username  *string
+}
+
+func (f nullableForwardRef) ref() *models.ForwardRef {
+	if !f.Forwarded {
+		return nil
+	}
+
+	ref := &models.ForwardRef{
+		MessageID: f.MessageID,
+		ChatID:    f.ChatID,
+		SenderID:  f.SenderID,
+	}
+	if f.Username != nil {
+		ref.Username = *f.Username
+	}
+	ref.Hidden = ref.SenderID == nil && ref.Username == ""
+	return ref
+}
+
+func nullIfEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func (cs *chatService) GetForwardSource(ctx context.Context, chatID, messageID int, hideSender bool) (*models.ForwardRef, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("id", "chat_id", "sender_id", "username", "deleted_at IS NOT NULL",
+			"is_forwarded", "forwarded_from_message_id", "forwarded_from_chat_id", "forwarded_from_sender_id", "forwarded_from_username").
+		From("messages").
+		Where(squirrel.Eq{
+			"id":      messageID,
+			"chat_id": chatID,
 		})
 
-	updateSQL, updateArgs, err := updateQuery.ToSql()
+	sqlStr, args, err := query.ToSql()
 	if err != nil {
 		log.Printf("Failed to build SQL query: %v", err)
-		return nil, nil, err
+		return nil, err
 	}
 
-	log.Printf("Executing SQL: %s, Args: %v", updateSQL, updateArgs)
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
 
-	_, err = db.Pool.Exec(ctx, updateSQL, updateArgs...)
+	var original models.ForwardRef
+	var deleted bool
+	var forward nullableForwardRef
+	original.MessageID, original.ChatID, original.SenderID = new(int), new(int), new(int)
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(
+		original.MessageID, original.ChatID, original.SenderID, &original.Username, &deleted,
+		&forward.Forwarded, &forward.MessageID, &forward.ChatID, &forward.SenderID, &forward.Username,
+	)
 	if err != nil {
-		log.Printf("Error marking messages as read for chat %d and recipient %d: %v", chatID, recipientID, err)
-		return nil, nil, err
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Message %d not found in chat %d", messageID, chatID)
+			return nil, models.ErrMessageNotFound
+		}
+		log.Printf("Error getting message %d: %v", messageID, err)
+		return nil, err
+	}
+	if deleted {
+		return nil, models.ErrMessageNotFound
 	}
 
-	log.Printf("Marked messages [%v] as read in chat %d for user %d", messageIDs, chatID, recipientID)
-	return messageIDs, senderIDs, nil
+	if hideSender {
+		return &models.ForwardRef{Hidden: true}, nil
+	}
+
+	// Forwarding a forward keeps the attribution of the original message.
+	if previous := forward.ref(); previous != nil {
+		return previous, nil
+	}
+	return &original, nil
 }
 
-func (cs *chatService) GetUnreadMessagesCount(ctx context.Context, chatID, userID int) (int, error) {
+func getMessageRef(ctx context.Context, q db.Querier, chatID, messageID int) (*models.MessageRef, error) {
 	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
-		Select("COUNT(*)").
+		Select("id", "sender_id", "username", "content", "deleted_at IS NOT NULL").
 		From("messages").
-		Where(squirrel.And{
-			squirrel.Eq{"chat_id": chatID},
-			squirrel.NotEq{"sender_id": userID},
-			squirrel.Eq{"read_at": nil},
+		Where(squirrel.Eq{
+			"id":      messageID,
+			"chat_id": chatID,
 		})
 
 	sqlStr, args, err := query.ToSql()
 	if err != nil {
 		log.Printf("Failed to build SQL query: %v", err)
-		return 0, err
+		return nil, err
 	}
 
-	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+	var ref models.MessageRef
+	err = q.QueryRow(ctx, sqlStr, args...).Scan(&ref.ID, &ref.SenderID, &ref.Username, &ref.Content, &ref.Deleted)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Message %d not found in chat %d", messageID, chatID)
+			return nil, models.ErrMessageNotFound
+		}
+		log.Printf("Error getting message %d: %v", messageID, err)
+		return nil, err
+	}
 
-	var count int
-	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&count)
+	if ref.Deleted {
+		ref.Content = ""
+	}
+	return &ref, nil
+}
+
+func replyToID(ref *models.MessageRef) *int {
+	if ref == nil {
+		return nil
+	}
+	return &ref.ID
+}
+
+func (cs *chatService) GetMessagesByChatId(ctx context.Context, chatID int, query models.MessageQuery) (*models.MessagePage, error) {
+	queryBuilder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("m.id", "m.chat_id", "m.seq", "m.sender_id", "m.username", "m.content", "m.sent_at", "m.read_at",
+			"m.client_message_id::text", "m.edited_at", "m.deleted_at",
+			"r.id", "r.sender_id", "r.username", "r.content", "r.deleted_at IS NOT NULL",
+			"m.thread_root_id", "m.thread_reply_count", "m.thread_last_reply_at",
+			"m.is_forwarded", "m.forwarded_from_message_id", "m.forwarded_from_chat_id", "m.forwarded_from_sender_id", "m.forwarded_from_username").
+		Column(squirrel.Expr(`CASE WHEN m.thread_reply_count = 0 THEN 0 ELSE (
+			SELECT COUNT(*) FROM messages t
+			WHERE t.thread_root_id = m.id AND t.sender_id <> ? AND t.deleted_at IS NULL AND t.seq > COALESCE(
+				(SELECT tr.last_read_seq FROM thread_reads tr WHERE tr.message_id = m.id AND tr.user_id = ?), 0)
+		) END`, query.ViewerID, query.ViewerID)).
+		From("messages m").
+		LeftJoin("messages r ON r.id = m.reply_to_message_id").
+		Where(squirrel.Eq{"m.chat_id": chatID}).
+		Limit(uint64(query.Limit + 1))
+
+	if query.ThreadRootID != 0 {
+		queryBuilder = queryBuilder.Where(squirrel.Eq{"m.thread_root_id": query.ThreadRootID})
+	} else {
+		queryBuilder = queryBuilder.Where(squirrel.Eq{"m.thread_root_id": nil})
+	}
+
+	if query.ViewerID != 0 {
+		queryBuilder = queryBuilder.Where(
+			"NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = ?)", query.ViewerID)
+	}
+
+	switch {
+	case query.AfterSeq != nil:
+		queryBuilder = queryBuilder.Where(squirrel.Gt{"m.seq": *query.AfterSeq}).OrderBy("m.seq ASC")
+	case query.BeforeSeq != nil:
+		queryBuilder = queryBuilder.Where(squirrel.Lt{"m.seq": *query.BeforeSeq}).OrderBy("m.seq DESC")
+	default:
+		queryBuilder = queryBuilder.OrderBy("m.seq DESC").Offset(uint64(query.Offset))
+	}
+
+	sqlQuery, args, err := queryBuilder.ToSql()
 	if err != nil {
-		log.Printf("Error getting unread messages count for chat %d and user %d: %v", chatID, userID, err)
-		return 0, err
+		log.Printf("Error building SQL query: %v", err)
+		return nil, errors.New("failed to build query")
 	}
 
-	log.Printf("Unread messages count for chat %d and user %d: %d", chatID, userID, count)
-	return count, nil
+	log.Printf("Executing SQL: %s, Args: %v", sqlQuery, args)
+
+	rows, err := db.Pool.Query(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Printf("Error executing query for chat %d: %v", chatID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]models.Message, 0)
+
+	for rows.Next() {
+		var msg models.Message
+		var readAt pgtype.Timestamptz
+		var reply nullableMessageRef
+		var thread models.ThreadInfo
+		var forward nullableForwardRef
+
+		err := rows.Scan(&msg.ID, &msg.ChatID, &msg.Seq, &msg.SenderID, &msg.Username, &msg.Content, &msg.SentAt, &readAt, &msg.ClientMessageID, &msg.EditedAt, &msg.DeletedAt,
+			&reply.ID, &reply.SenderID, &reply.Username, &reply.Content, &reply.Deleted,
+			&msg.ThreadRootID, &thread.ReplyCount, &thread.LastReplyAt,
+			&forward.Forwarded, &forward.MessageID, &forward.ChatID, &forward.SenderID, &forward.Username,
+			&thread.UnreadCount)
+		if err != nil {
+			log.Printf("Error scanning row: %v", err)
+			return nil, err
+		}
+		msg.ReplyTo = reply.ref()
+		msg.ForwardedFrom = forward.ref()
+		if thread.ReplyCount > 0 {
+			msg.Thread = &thread
+		}
+
+		if readAt.Status == pgtype.Present {
+			msg.ReadAt = &readAt.Time
+		} else {
+			msg.ReadAt = nil
+		}
+
+		messages = append(messages, msg)
+	}
+
+	if rows.Err() != nil {
+		log.Printf("Error after iterating rows: %v", rows.Err())
+		return nil, rows.Err()
+	}
+
+	if query.ViewerID != 0 {
+		if err := setMessageStatuses(ctx, chatID, query.ViewerID, messages); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setMessageReactions(ctx, query.ViewerID, messages); err != nil {
+		return nil, err
+	}
+
+	if err := setMessageFiles(ctx, db.Pool, messages); err != nil {
+		return nil, err
+	}
+
+	page := &models.MessagePage{Messages: messages}
+	if len(messages) > query.Limit {
+		page.Messages = messages[:query.Limit]
+		page.HasMore = true
+		nextCursor := page.Messages[query.Limit-1].Seq
+		page.NextCursor = &nextCursor
+	}
+
+	log.Printf("Fetched %d messages for chat %d", len(page.Messages), chatID)
+	return page, nil
+}
+
+func (cs *chatService) EditMessage(ctx context.Context, chatID, messageID, editorID int, content string, window time.Duration) (*models.Message, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	selectQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("chat_id", "seq", "sender_id", "username", "content", "sent_at").
+		Column(squirrel.Expr("sent_at < NOW() - make_interval(secs => ?)", window.Seconds())).
+		From("messages").
+		Where(squirrel.Eq{
+			"id":         messageID,
+			"chat_id":    chatID,
+			"deleted_at": nil,
+		}).
+		Suffix("FOR UPDATE")
+
+	sqlStr, args, err := selectQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	msg := models.Message{ID: messageID, Encrypted: true}
+	var previousContent string
+	var expired bool
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(&msg.ChatID, &msg.Seq, &msg.SenderID, &msg.Username, &previousContent, &msg.SentAt, &expired)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Message %d not found in chat %d", messageID, chatID)
+			return nil, models.ErrMessageNotFound
+		}
+		log.Printf("Error getting message %d: %v", messageID, err)
+		return nil, err
+	}
+
+	if msg.SenderID != editorID {
+		log.Printf("User %d is not the sender of message %d", editorID, messageID)
+		return nil, models.ErrNotMessageSender
+	}
+	if expired {
+		log.Printf("Edit window of message %d has expired", messageID)
+		return nil, models.ErrEditWindowExpired
+	}
+
+	historyQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("message_edits").
+		Columns("message_id", "editor_id", "content").
+		Values(messageID, editorID, previousContent)
+
+	sqlStr, args, err = historyQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	if _, err := tx.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error saving previous version of message %d: %v", messageID, err)
+		return nil, err
+	}
+
+	updateQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("messages").
+		Set("content", content).
+		Set("edited_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": messageID}).
+		Suffix("RETURNING edited_at")
+
+	sqlStr, args, err = updateQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var editedAt time.Time
+	if err := tx.QueryRow(ctx, sqlStr, args...).Scan(&editedAt); err != nil {
+		log.Printf("Error updating message %d: %v", messageID, err)
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	msg.Content = content
+	msg.EditedAt = &editedAt
+	log.Printf("Message %d in chat %d edited by user %d", messageID, msg.ChatID, editorID)
+	return &msg, nil
+}
+
+func (cs *chatService) GetMessageEdits(ctx context.Context, chatID, messageID int) ([]models.MessageEdit, error) {
+	if _, err := getMessageSeq(ctx, db.Pool, chatID, messageID); err != nil {
+		return nil, err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("id", "message_id", "editor_id", "content", "edited_at").
+		From("message_edits").
+		Where(squirrel.Eq{"message_id": messageID}).
+		OrderBy("id ASC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting edits of message %d: %v", messageID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := make([]models.MessageEdit, 0)
+	for rows.Next() {
+		var edit models.MessageEdit
+		if err := rows.Scan(&edit.ID, &edit.MessageID, &edit.EditorID, &edit.Content, &edit.EditedAt); err != nil {
+			log.Printf("Error scanning message edit: %v", err)
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over message edits: %v", err)
+		return nil, err
+	}
+
+	return edits, nil
+}
+
+func (cs *chatService) HideMessage(ctx context.Context, chatID, messageID, userID int) error {
+	if _, err := getMessageSeq(ctx, db.Pool, chatID, messageID); err != nil {
+		return err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("hidden_messages").
+		Columns("message_id", "user_id").
+		Values(messageID, userID).
+		Suffix("ON CONFLICT (message_id, user_id) DO NOTHING")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	if _, err := db.Pool.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error hiding message %d for user %d: %v", messageID, userID, err)
+		return err
+	}
+
+	log.Printf("Message %d in chat %d hidden for user %d", messageID, chatID, userID)
+	return nil
+}
+
+func (cs *chatService) DeleteMessageForEveryone(ctx context.Context, chatID, messageID, userID int, window time.Duration) (*models.Message, error) {
+	isCreator, err := cs.IsChatCreator(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	selectQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("seq", "sender_id", "thread_root_id").
+		Column(squirrel.Expr("sent_at < NOW() - make_interval(secs => ?)", window.Seconds())).
+		From("messages").
+		Where(squirrel.Eq{
+			"id":         messageID,
+			"chat_id":    chatID,
+			"deleted_at": nil,
+		}).
+		Suffix("FOR UPDATE")
+
+	sqlStr, args, err := selectQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	msg := models.Message{ID: messageID, ChatID: chatID, Encrypted: true}
+	var expired bool
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(&msg.Seq, &msg.SenderID, &msg.ThreadRootID, &expired)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Message %d not found in chat %d", messageID, chatID)
+			return nil, models.ErrMessageNotFound
+		}
+		log.Printf("Error getting message %d: %v", messageID, err)
+		return nil, err
+	}
+
+	if !isCreator {
+		if msg.SenderID != userID {
+			log.Printf("User %d may not delete message %d", userID, messageID)
+			return nil, models.ErrNotMessageSender
+		}
+		if expired {
+			log.Printf("Delete window of message %d has expired", messageID)
+			return nil, models.ErrDeleteWindowExpired
+		}
+	}
+
+	updateQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("messages").
+		Set("content", "").
+		Set("deleted_at", squirrel.Expr("NOW()")).
+		Set("deleted_by", userID).
+		Where(squirrel.Eq{"id": messageID}).
+		Suffix("RETURNING deleted_at")
+
+	sqlStr, args, err = updateQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var deletedAt time.Time
+	if err := tx.QueryRow(ctx, sqlStr, args...).Scan(&deletedAt); err != nil {
+		log.Printf("Error deleting message %d: %v", messageID, err)
+		return nil, err
+	}
+
+	// Earlier versions and attachments would still expose the deleted content.
+	// Their blobs are removed by the storage GC once no other file refers to them.
+	for _, table := range []string{"message_edits", "message_reactions", "pinned_messages", "files"} {
+		deleteQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+			Delete(table).
+			Where(squirrel.Eq{"message_id": messageID})
+
+		sqlStr, args, err = deleteQuery.ToSql()
+		if err != nil {
+			log.Printf("Failed to build SQL query: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+		if _, err := tx.Exec(ctx, sqlStr, args...); err != nil {
+			log.Printf("Error deleting %s of message %d: %v", table, messageID, err)
+			return nil, err
+		}
+	}
+
+	if msg.ThreadRootID != nil {
+		rootQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+			Update("messages").
+			Set("thread_reply_count", squirrel.Expr("GREATEST(thread_reply_count - 1, 0)")).
+			Set("thread_last_reply_at", squirrel.Expr(
+				"(SELECT MAX(sent_at) FROM messages WHERE thread_root_id = ? AND deleted_at IS NULL)", *msg.ThreadRootID)).
+			Where(squirrel.Eq{"id": *msg.ThreadRootID})
+
+		sqlStr, args, err = rootQuery.ToSql()
+		if err != nil {
+			log.Printf("Failed to build SQL query: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+		if _, err := tx.Exec(ctx, sqlStr, args...); err != nil {
+			log.Printf("Error updating thread root %d: %v", *msg.ThreadRootID, err)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	msg.DeletedAt = &deletedAt
+	log.Printf("Message %d in chat %d deleted for everyone by user %d", messageID, chatID, userID)
+	return &msg, nil
+}
+
+func (cs *chatService) GetThread(ctx context.Context, chatID, rootID, viewerID int) (*models.Thread, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("m.id", "m.sender_id", "m.username", "m.content", "m.deleted_at IS NOT NULL", "m.thread_reply_count", "m.thread_last_reply_at").
+		Column(squirrel.Expr(`(
+			SELECT COUNT(*) FROM messages t
+			WHERE t.thread_root_id = m.id AND t.sender_id <> ? AND t.deleted_at IS NULL AND t.seq > COALESCE(
+				(SELECT tr.last_read_seq FROM thread_reads tr WHERE tr.message_id = m.id AND tr.user_id = ?), 0)
+		)`, viewerID, viewerID)).
+		From("messages m").
+		Where(squirrel.Eq{
+			"m.id":             rootID,
+			"m.chat_id":        chatID,
+			"m.thread_root_id": nil,
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	thread := models.Thread{Root: &models.MessageRef{}}
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(
+		&thread.Root.ID, &thread.Root.SenderID, &thread.Root.Username, &thread.Root.Content, &thread.Root.Deleted,
+		&thread.ReplyCount, &thread.LastReplyAt, &thread.UnreadCount,
+	)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Thread root %d not found in chat %d", rootID, chatID)
+			return nil, models.ErrMessageNotFound
+		}
+		log.Printf("Error getting thread %d: %v", rootID, err)
+		return nil, err
+	}
+
+	if thread.Root.Deleted {
+		thread.Root.Content = ""
+	}
+	return &thread, nil
+}
+
+func (cs *chatService) MarkThreadAsRead(ctx context.Context, chatID, rootID, userID, lastReadMessageID int) (int64, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("seq").
+		From("messages").
+		Where(squirrel.Eq{
+			"id":             lastReadMessageID,
+			"chat_id":        chatID,
+			"thread_root_id": rootID,
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var seq int64
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&seq)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Message %d is not a reply in thread %d", lastReadMessageID, rootID)
+			return 0, models.ErrMessageNotFound
+		}
+		log.Printf("Error getting sequence number of message %d: %v", lastReadMessageID, err)
+		return 0, err
+	}
+
+	if err := advanceThreadPointer(ctx, db.Pool, rootID, userID, seq); err != nil {
+		return 0, err
+	}
+
+	log.Printf("User %d read thread %d up to message %d", userID, rootID, lastReadMessageID)
+	return seq, nil
+}
+
+func advanceThreadPointer(ctx context.Context, q db.Querier, rootID, userID int, seq int64) error {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("thread_reads").
+		Columns("message_id", "user_id", "last_read_seq").
+		Values(rootID, userID, seq).
+		Suffix(`ON CONFLICT (message_id, user_id) DO UPDATE
+			SET last_read_seq = GREATEST(thread_reads.last_read_seq, EXCLUDED.last_read_seq), last_read_at = NOW()`)
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	if _, err := q.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error moving read pointer of user %d in thread %d: %v", userID, rootID, err)
+		return err
+	}
+	return nil
+}
+
+func (cs *chatService) AddReaction(ctx context.Context, chatID, messageID, userID int, emoji string) (bool, error) {
+	ref, err := getMessageRef(ctx, db.Pool, chatID, messageID)
+	if err != nil {
+		return false, err
+	}
+	if ref.Deleted {
+		return false, models.ErrMessageNotFound
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("message_reactions").
+		Columns("message_id", "user_id", "emoji").
+		Values(messageID, userID, emoji).
+		Suffix("ON CONFLICT (message_id, user_id, emoji) DO NOTHING")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return false, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	result, err := db.Pool.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error adding reaction %s to message %d: %v", emoji, messageID, err)
+		return false, err
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+func (cs *chatService) RemoveReaction(ctx context.Context, chatID, messageID, userID int, emoji string) (bool, error) {
+	if _, err := getMessageSeq(ctx, db.Pool, chatID, messageID); err != nil {
+		return false, err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Delete("message_reactions").
+		Where(squirrel.Eq{
+			"message_id": messageID,
+			"user_id":    userID,
+			"emoji":      emoji,
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return false, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	result, err := db.Pool.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error removing reaction %s from message %d: %v", emoji, messageID, err)
+		return false, err
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+func (cs *chatService) GetReactions(ctx context.Context, messageID int) ([]models.Reaction, error) {
+	messages := []models.Message{{ID: messageID}}
+	if err := setMessageReactions(ctx, 0, messages); err != nil {
+		return nil, err
+	}
+
+	if messages[0].Reactions == nil {
+		return make([]models.Reaction, 0), nil
+	}
+	return messages[0].Reactions, nil
+}
+
+func (cs *chatService) PinMessage(ctx context.Context, chatID, messageID, userID, limit int) (*models.PinnedMessage, bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the chat so that concurrent pins cannot exceed the limit.
+	countQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("(SELECT COUNT(*) FROM pinned_messages p WHERE p.chat_id = c.id)").
+		Column("EXISTS (SELECT 1 FROM pinned_messages p WHERE p.chat_id = c.id AND p.message_id = ?)", messageID).
+		From("chats c").
+		Where(squirrel.Eq{"c.id": chatID}).
+		Suffix("FOR UPDATE")
+
+	sqlStr, args, err := countQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, false, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var pinned int
+	var alreadyPinned bool
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(&pinned, &alreadyPinned)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Chat %d not found", chatID)
+			return nil, false, models.ErrChatNotFound
+		}
+		log.Printf("Error counting pinned messages of chat %d: %v", chatID, err)
+		return nil, false, err
+	}
+
+	// Pinning a message again stays a no-op when the chat is full.
+	if pinned >= limit && !alreadyPinned {
+		log.Printf("Chat %d already has %d pinned messages", chatID, pinned)
+		return nil, false, models.ErrPinLimitReached
+	}
+
+	ref, err := getMessageRef(ctx, tx, chatID, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+	if ref.Deleted {
+		return nil, false, models.ErrMessageNotFound
+	}
+
+	insertQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("pinned_messages").
+		Columns("chat_id", "message_id", "pinned_by").
+		Values(chatID, messageID, userID).
+		Suffix("ON CONFLICT (chat_id, message_id) DO NOTHING RETURNING pinned_at")
+
+	sqlStr, args, err = insertQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, false, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	pin := &models.PinnedMessage{ChatID: chatID, Message: *ref, PinnedBy: userID}
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(&pin.PinnedAt)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Message %d is already pinned in chat %d", messageID, chatID)
+			return pin, false, nil
+		}
+		log.Printf("Error pinning message %d in chat %d: %v", messageID, chatID, err)
+		return nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, false, err
+	}
+
+	log.Printf("Message %d pinned in chat %d by user %d", messageID, chatID, userID)
+	return pin, true, nil
+}
+
+func (cs *chatService) UnpinMessage(ctx context.Context, chatID, messageID int) (bool, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Delete("pinned_messages").
+		Where(squirrel.Eq{
+			"chat_id":    chatID,
+			"message_id": messageID,
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return false, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	result, err := db.Pool.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error unpinning message %d in chat %d: %v", messageID, chatID, err)
+		return false, err
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+func (cs *chatService) GetPinnedMessages(ctx context.Context, chatID int) ([]models.PinnedMessage, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("p.chat_id", "m.id", "m.sender_id", "m.username", "m.content", "p.pinned_by", "p.pinned_at").
+		From("pinned_messages p").
+		Join("messages m ON m.id = p.message_id").
+		Where(squirrel.Eq{"p.chat_id": chatID}).
+		OrderBy("p.pinned_at DESC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting pinned messages of chat %d: %v", chatID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := make([]models.PinnedMessage, 0)
+	for rows.Next() {
+		var pin models.PinnedMessage
+		err := rows.Scan(&pin.ChatID, &pin.Message.ID, &pin.Message.SenderID, &pin.Message.Username, &pin.Message.Content, &pin.PinnedBy, &pin.PinnedAt)
+		if err != nil {
+			log.Printf("Error scanning pinned message: %v", err)
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over pinned messages: %v", err)
+		return nil, err
+	}
+
+	return pins, nil
+}
+
+// setMessageReactions attaches aggregated reactions to the given messages.
+// ReactedByMe is only set when a viewer is given.
+func setMessageReactions(ctx context.Context, viewerID int, messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	messageIDs := make([]int, 0, len(messages))
+	index := make(map[int]int, len(messages))
+	for i, msg := range messages {
+		messageIDs = append(messageIDs, msg.ID)
+		index[msg.ID] = i
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("message_id", "emoji", "COUNT(*)").
+		Column(squirrel.Expr("BOOL_OR(user_id = ?)", viewerID)).
+		From("message_reactions").
+		Where(squirrel.Eq{"message_id": messageIDs}).
+		GroupBy("message_id", "emoji").
+		OrderBy("MIN(created_at) ASC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting reactions: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var reaction models.Reaction
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count, &reaction.ReactedByMe); err != nil {
+			log.Printf("Error scanning reaction: %v", err)
+			return err
+		}
+		i := index[messageID]
+		messages[i].Reactions = append(messages[i].Reactions, reaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over reactions: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// setMessageStatuses fills in the delivery status of the viewer's own
+// messages. A message counts as delivered or read once every other
+// participant has reached it.
+func setMessageStatuses(ctx context.Context, chatID, viewerID int, messages []models.Message) error {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("COALESCE(MIN(last_delivered_seq), 0)", "COALESCE(MIN(last_read_seq), 0)").
+		From("chat_participants").
+		Where(squirrel.And{
+			squirrel.Eq{"chat_id": chatID},
+			squirrel.NotEq{"user_id": viewerID},
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var deliveredSeq, readSeq int64
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&deliveredSeq, &readSeq)
+	if err != nil {
+		log.Printf("Error getting delivery pointers for chat %d: %v", chatID, err)
+		return err
+	}
+
+	for i := range messages {
+		if messages[i].SenderID != viewerID {
+			continue
+		}
+		switch {
+		case messages[i].Seq <= readSeq:
+			messages[i].Status = models.MessageStatusRead
+		case messages[i].Seq <= deliveredSeq:
+			messages[i].Status = models.MessageStatusDelivered
+		default:
+			messages[i].Status = models.MessageStatusSent
+		}
+	}
+
+	return nil
+}
+
+func (cs *chatService) IsUserParticipant(ctx context.Context, chatID, userID int) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1
+            FROM chat_participants
+            WHERE chat_id = $1 AND user_id = $2
+        )
+    `
+
+	var exists bool
+	err := db.Pool.QueryRow(ctx, query, chatID, userID).Scan(&exists)
+	if err != nil {
+		log.Printf("Error checking if user %d is a participant of chat %d: %v", userID, chatID, err)
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (cs *chatService) MarkMessagesAsRead(ctx context.Context, chatID, recipientID, lastReadMessageID int) ([]int, []int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	lastReadSeq, err := getMessageSeq(ctx, tx, chatID, lastReadMessageID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previousSeq, err := advanceParticipantPointer(ctx, tx, chatID, recipientID, "last_read_seq", "last_read_at", lastReadSeq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if previousSeq >= lastReadSeq {
+		log.Printf("Read pointer of user %d in chat %d is already at %d", recipientID, chatID, previousSeq)
+		return nil, nil, nil
+	}
+
+	// A message that has been read has also been delivered.
+	if _, err := advanceParticipantPointer(ctx, tx, chatID, recipientID, "last_delivered_seq", "last_delivered_at", lastReadSeq); err != nil {
+		return nil, nil, err
+	}
+
+	messageIDs, senderIDs, err := getIncomingMessages(ctx, tx, chatID, recipientID, previousSeq, lastReadSeq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(messageIDs) > 0 {
+		updateQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+			Update("messages").
+			Set("read_at", squirrel.Expr("NOW()")).
+			Where(squirrel.And{
+				squirrel.Eq{"id": messageIDs},
+				squirrel.Eq{"read_at": nil},
+			})
+
+		updateSQL, updateArgs, err := updateQuery.ToSql()
+		if err != nil {
+			log.Printf("Failed to build SQL query: %v", err)
+			return nil, nil, err
+		}
+
+		log.Printf("Executing SQL: %s, Args: %v", updateSQL, updateArgs)
+
+		if _, err := tx.Exec(ctx, updateSQL, updateArgs...); err != nil {
+			log.Printf("Error marking messages as read for chat %d and recipient %d: %v", chatID, recipientID, err)
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, nil, err
+	}
+
+	log.Printf("Marked messages [%v] as read in chat %d for user %d (read pointer %d)", messageIDs, chatID, recipientID, lastReadSeq)
+	return messageIDs, senderIDs, nil
+}
+
+func (cs *chatService) MarkMessagesAsDelivered(ctx context.Context, chatID, recipientID, lastDeliveredMessageID int) ([]int, []int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	lastDeliveredSeq, err := getMessageSeq(ctx, tx, chatID, lastDeliveredMessageID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previousSeq, err := advanceParticipantPointer(ctx, tx, chatID, recipientID, "last_delivered_seq", "last_delivered_at", lastDeliveredSeq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if previousSeq >= lastDeliveredSeq {
+		log.Printf("Delivery pointer of user %d in chat %d is already at %d", recipientID, chatID, previousSeq)
+		return nil, nil, nil
+	}
+
+	messageIDs, senderIDs, err := getIncomingMessages(ctx, tx, chatID, recipientID, previousSeq, lastDeliveredSeq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, nil, err
+	}
+
+	log.Printf("Marked messages [%v] as delivered in chat %d for user %d (delivery pointer %d)", messageIDs, chatID, recipientID, lastDeliveredSeq)
+	return messageIDs, senderIDs, nil
+}
+
+// advanceParticipantPointer moves a per-participant sequence pointer forward
+// and returns its previous value. The pointer never moves backwards.
+func advanceParticipantPointer(ctx context.Context, tx pgxv4.Tx, chatID, userID int, seqColumn, atColumn string, seq int64) (int64, error) {
+	pointerQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select(seqColumn).
+		From("chat_participants").
+		Where(squirrel.Eq{
+			"chat_id": chatID,
+			"user_id": userID,
+		}).
+		Suffix("FOR UPDATE")
+
+	sqlStr, args, err := pointerQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var previousSeq int64
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(&previousSeq)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("User %d is not a participant of chat %d", userID, chatID)
+			return 0, models.ErrUserNotParticipant
+		}
+		log.Printf("Error getting %s of user %d in chat %d: %v", seqColumn, userID, chatID, err)
+		return 0, err
+	}
+
+	if previousSeq >= seq {
+		return previousSeq, nil
+	}
+
+	updateQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("chat_participants").
+		Set(seqColumn, seq).
+		Set(atColumn, squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{
+			"chat_id": chatID,
+			"user_id": userID,
+		})
+
+	sqlStr, args, err = updateQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	if _, err := tx.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error moving %s of user %d in chat %d: %v", seqColumn, userID, chatID, err)
+		return 0, err
+	}
+
+	return previousSeq, nil
+}
+
+// getIncomingMessages returns the main timeline messages in the (fromSeq,
+// toSeq] range not sent by the given user, together with the distinct IDs of
+// their senders. Thread replies have their own read pointers.
+func getIncomingMessages(ctx context.Context, q db.Querier, chatID, userID int, fromSeq, toSeq int64) ([]int, []int, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("id", "sender_id").
+		From("messages").
+		Where(squirrel.And{
+			squirrel.Eq{"chat_id": chatID},
+			squirrel.Gt{"seq": fromSeq},
+			squirrel.LtOrEq{"seq": toSeq},
+			squirrel.NotEq{"sender_id": userID},
+			squirrel.Eq{"thread_root_id": nil},
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := q.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error fetching messages for chat %d and recipient %d: %v", chatID, userID, err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var messageIDs []int
+	var senderIDsMap = make(map[int]struct{})
+	for rows.Next() {
+		var id, senderID int
+		err := rows.Scan(&id, &senderID)
+		if err != nil {
+			log.Printf("Error scanning message ID or sender ID: %v", err)
+			continue
+		}
+		messageIDs = append(messageIDs, id)
+		senderIDsMap[senderID] = struct{}{}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over messages: %v", err)
+		return nil, nil, err
+	}
+
+	var senderIDs []int
+	for senderID := range senderIDsMap {
+		senderIDs = append(senderIDs, senderID)
+	}
+
+	return messageIDs, senderIDs, nil
+}
+
+func (cs *chatService) GetUnreadMessagesCount(ctx context.Context, chatID, userID int) (int, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("COUNT(*)").
+		From("messages m").
+		Join("chat_participants cp ON cp.chat_id = m.chat_id AND cp.user_id = ?", userID).
+		Where(squirrel.And{
+			squirrel.Eq{"m.chat_id": chatID},
+			squirrel.NotEq{"m.sender_id": userID},
+			squirrel.Eq{"m.thread_root_id": nil},
+			squirrel.Expr("m.seq > cp.last_read_seq"),
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var count int
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&count)
+	if err != nil {
+		log.Printf("Error getting unread messages count for chat %d and user %d: %v", chatID, userID, err)
+		return 0, err
+	}
+
+	log.Printf("Unread messages count for chat %d and user %d: %d", chatID, userID, count)
+	return count, nil
+}
+
+func (cs *chatService) GetMessageReaders(ctx context.Context, chatID, messageID int) ([]models.MessageRead, error) {
+	if _, err := getMessageSeq(ctx, db.Pool, chatID, messageID); err != nil {
+		return nil, err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("u.id", "u.username",
+			"CASE WHEN m.thread_root_id IS NULL THEN cp.last_read_at ELSE tr.last_read_at END AS read_at").
+		From("messages m").
+		Join("chat_participants cp ON cp.chat_id = m.chat_id AND cp.user_id <> m.sender_id").
+		// Thread replies are read through the thread's own pointer, not the chat's.
+		LeftJoin("thread_reads tr ON m.thread_root_id IS NOT NULL AND tr.message_id = m.thread_root_id AND tr.user_id = cp.user_id").
+		Join("users u ON u.id = cp.user_id").
+		Where(squirrel.Eq{
+			"m.id":      messageID,
+			"m.chat_id": chatID,
+		}).
+		Where("CASE WHEN m.thread_root_id IS NULL THEN cp.last_read_seq ELSE tr.last_read_seq END >= m.seq").
+		OrderBy("read_at ASC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting readers of message %d in chat %d: %v", messageID, chatID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	readers := make([]models.MessageRead, 0)
+	for rows.Next() {
+		var reader models.MessageRead
+		if err := rows.Scan(&reader.UserID, &reader.Username, &reader.ReadAt); err != nil {
+			log.Printf("Error scanning message reader: %v", err)
+			return nil, err
+		}
+		readers = append(readers, reader)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over message readers: %v", err)
+		return nil, err
+	}
+
+	return readers, nil
+}
+
+func getMessageSeq(ctx context.Context, q db.Querier, chatID, messageID int) (int64, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("seq").
+		From("messages").
+		Where(squirrel.Eq{
+			"id":      messageID,
+			"chat_id": chatID,
+		})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return 0, err
+	}
+
+	var seq int64
+	err = q.QueryRow(ctx, sqlStr, args...).Scan(&seq)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			log.Printf("Message %d not found in chat %d", messageID, chatID)
+			return 0, models.ErrMessageNotFound
+		}
+		log.Printf("Error getting sequence number of message %d: %v", messageID, err)
+		return 0, err
+	}
+
+	return seq, nil
 }
 
 func (cs *chatService) GetParticipants(ctx context.Context, chatID int) ([]models.User, error) {
@@ -658,8 +2135,8 @@ func (cs *chatService) RemoveParticipant(ctx context.Context, chatID, userID int
 func (cs *chatService) AddParticipant(ctx context.Context, chatID, userID int) error {
 	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
 		Insert("chat_participants").
-		Columns("chat_id", "user_id").
-		Values(chatID, userID)
+		Columns("chat_id", "user_id", "last_read_seq", "last_delivered_seq").
+		Values(chatID, userID, chatHeadSeq(chatID), chatHeadSeq(chatID))
 	sqlStr, args, err := query.ToSql()
 	if err != nil {
 		log.Printf("Failed to build SQL query: %v", err)
@@ -780,8 +2257,8 @@ func (cs *chatService) JoinChat(ctx context.Context, chatID, userID int) error {
 
 	insertQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
 		Insert("chat_participants").
-		Columns("chat_id", "user_id", "encrypted_chat_key").
-		Values(chatID, userID, encryptedKey)
+		Columns("chat_id", "user_id", "encrypted_chat_key", "last_read_seq", "last_delivered_seq").
+		Values(chatID, userID, encryptedKey, chatHeadSeq(chatID), chatHeadSeq(chatID))
 	sqlStr, args, err = insertQuery.ToSql()
 	if err != nil {
 		log.Printf("Failed to build SQL query: %v", err)
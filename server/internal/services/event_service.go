@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"SecureMessenger/server/internal/db"
+	"SecureMessenger/server/internal/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+)
+
+type EventService interface {
+	AppendEvent(ctx context.Context, userIDs []int, chatID *int, eventType string, data interface{}) (map[int]int64, error)
+	GetEventsSince(ctx context.Context, userID int, since int64, limit int) ([]models.Event, error)
+	PruneEvents(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+type eventService struct{}
+
+func NewEventService() EventService {
+	return &eventService{}
+}
+
+// AppendEvent gives every event the next cursor of its user. The counter rows
+// in user_event_seqs stay locked until the events are committed, so the
+// cursors of one user always become visible in order and GetEventsSince never
+// skips an event.
+func (es *eventService) AppendEvent(ctx context.Context, userIDs []int, chatID *int, eventType string, data interface{}) (map[int]int64, error) {
+	if len(userIDs) == 0 {
+		return map[int]int64{}, nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding payload of %s event: %v", eventType, err)
+		return nil, err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Counters are locked in a fixed order so that concurrent events for
+	// overlapping sets of users cannot deadlock.
+	seqQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("user_event_seqs").
+		Columns("user_id", "last_seq").
+		Select(squirrel.Select("id", "1").
+			From("users").
+			Where(squirrel.Eq{"id": userIDs}).
+			OrderBy("id")).
+		Suffix("ON CONFLICT (user_id) DO UPDATE SET last_seq = user_event_seqs.last_seq + 1 RETURNING user_id, last_seq")
+
+	sqlStr, args, err := seqQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error allocating event sequence numbers: %v", err)
+		return nil, err
+	}
+
+	cursors := make(map[int]int64, len(userIDs))
+	for rows.Next() {
+		var userID int
+		var cursor int64
+		if err := rows.Scan(&userID, &cursor); err != nil {
+			rows.Close()
+			log.Printf("Error scanning event cursor: %v", err)
+			return nil, err
+		}
+		cursors[userID] = cursor
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over event cursors: %v", err)
+		return nil, err
+	}
+	if len(cursors) == 0 {
+		return cursors, nil
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("user_events").
+		Columns("user_id", "seq", "chat_id", "event_type", "payload")
+	for userID, cursor := range cursors {
+		query = query.Values(userID, cursor, chatID, eventType, string(payload))
+	}
+
+	sqlStr, args, err = query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error appending %s event: %v", eventType, err)
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Appended %s event for %d users", eventType, len(cursors))
+	return cursors, nil
+}
+
+// GetEventsSince returns a *models.CursorExpiredError if events after since
+// have already been pruned.
+func (es *eventService) GetEventsSince(ctx context.Context, userID int, since int64, limit int) ([]models.Event, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("seq", "user_id", "chat_id", "event_type", "payload", "created_at").
+		From("user_events").
+		Where(squirrel.And{
+			squirrel.Eq{"user_id": userID},
+			squirrel.Gt{"seq": since},
+		}).
+		OrderBy("seq ASC").
+		Limit(uint64(limit))
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting events for user %d since %d: %v", userID, since, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]models.Event, 0)
+	for rows.Next() {
+		var event models.Event
+		var payload []byte
+		err := rows.Scan(&event.Cursor, &event.UserID, &event.ChatID, &event.EventType, &payload, &event.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning event row: %v", err)
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over events: %v", err)
+		return nil, err
+	}
+
+	// The horizon is read after the events: pruning that removed any of them
+	// has then committed and is visible here.
+	horizonQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("COALESCE(s.last_seq, 0)", "COALESCE(s.pruned_seq, 0)").
+		From("users u").
+		LeftJoin("user_event_seqs s ON s.user_id = u.id").
+		Where(squirrel.Eq{"u.id": userID})
+
+	sqlStr, args, err = horizonQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	var lastSeq, prunedSeq int64
+	if err := db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&lastSeq, &prunedSeq); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.ErrUserNotFound
+		}
+		log.Printf("Error getting event horizon of user %d: %v", userID, err)
+		return nil, err
+	}
+
+	if since < prunedSeq || since > lastSeq {
+		log.Printf("Cursor %d of user %d is outside of %d..%d", since, userID, prunedSeq, lastSeq)
+		return nil, &models.CursorExpiredError{Cursor: lastSeq}
+	}
+
+	return events, nil
+}
+
+// PruneEvents deletes old events and remembers the newest pruned cursor of
+// every affected user.
+func (es *eventService) PruneEvents(ctx context.Context, olderThan time.Duration) (int64, error) {
+	sqlStr := `WITH pruned AS (
+		DELETE FROM user_events
+		WHERE created_at < NOW() - make_interval(secs => $1)
+		RETURNING user_id, seq
+	), horizons AS (
+		UPDATE user_event_seqs s
+		SET pruned_seq = GREATEST(s.pruned_seq, p.seq)
+		FROM (SELECT user_id, MAX(seq) AS seq FROM pruned GROUP BY user_id) p
+		WHERE s.user_id = p.user_id
+	)
+	SELECT COUNT(*) FROM pruned`
+
+	var pruned int64
+	if err := db.Pool.QueryRow(ctx, sqlStr, olderThan.Seconds()).Scan(&pruned); err != nil {
+		log.Printf("Error pruning events: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Pruned %d events older than %s", pruned, olderThan)
+	return pruned, nil
+}
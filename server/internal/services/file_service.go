@@ -0,0 +1,559 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"SecureMessenger/server/internal/db"
+	"SecureMessenger/server/internal/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+)
+
+var fileColumns = []string{"id", "message_id", "chat_id", "uploader_id", "file_name", "content_type", "media_type", "size", "storage_key", "uploaded_at", "thumbnail_file_id"}
+
+type FileService interface {
+	CreateFile(ctx context.Context, file *models.File, quotas []models.QuotaCheck) error
+	GetFileById(ctx context.Context, id int) (*models.File, error)
+	GetChatMedia(ctx context.Context, chatID, viewerID int, mediaType string, cursor, limit int) (*models.MediaPage, error)
+	DeleteExpiredFiles(ctx context.Context, retention, unattachedTTL time.Duration) (int64, error)
+	DeleteUnreferencedObjects(ctx context.Context, grace time.Duration, limit int) ([]string, error)
+}
+
+type fileService struct{}
+
+func NewFileService() FileService {
+	return &fileService{}
+}
+
+// CreateFile stores the metadata of an uploaded blob if it fits into the
+// given quotas. When a blob with the same hash is already stored,
+// file.StorageKey is replaced with the key of the existing object and the
+// caller can delete its copy.
+func (fs *fileService) CreateFile(ctx context.Context, file *models.File, quotas []models.QuotaCheck) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := reserveQuota(ctx, tx, quotas, file.Size); err != nil {
+		return err
+	}
+
+	if err := insertFile(ctx, tx, file); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (fs *fileService) GetFileById(ctx context.Context, id int) (*models.File, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select(fileColumns...).
+		From("files").
+		Where(squirrel.Eq{"id": id}).
+		Where(squirrel.NotEq{"storage_key": nil})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	file, err := scanFile(db.Pool.QueryRow(ctx, sqlStr, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("File %d not found", id)
+			return nil, models.ErrFileNotFound
+		}
+		log.Printf("Error getting file %d: %v", id, err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// GetChatMedia lists the attachments of a chat, newest first. The cursor is
+// the ID of the last file of the previous page.
+func (fs *fileService) GetChatMedia(ctx context.Context, chatID, viewerID int, mediaType string, cursor, limit int) (*models.MediaPage, error) {
+	columns := make([]string, 0, len(fileColumns)+3)
+	for _, column := range fileColumns {
+		columns = append(columns, "f."+column)
+	}
+	columns = append(columns, "m.sender_id", "m.username", "m.sent_at")
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select(columns...).
+		From("files f").
+		Join("messages m ON m.id = f.message_id").
+		Where(squirrel.Eq{"f.chat_id": chatID}).
+		Where(squirrel.NotEq{"f.storage_key": nil}).
+		Where(squirrel.Eq{"m.deleted_at": nil}).
+		Where("NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = ?)", viewerID).
+		OrderBy("f.id DESC").
+		Limit(uint64(limit + 1))
+
+	if mediaType != "" {
+		query = query.Where(squirrel.Eq{"f.media_type": mediaType})
+	}
+	if cursor > 0 {
+		query = query.Where(squirrel.Lt{"f.id": cursor})
+	}
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting media of chat %d: %v", chatID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]models.MediaItem, 0)
+	for rows.Next() {
+		var item models.MediaItem
+		fields := append(fileFields(&item.File), &item.SenderID, &item.Username, &item.SentAt)
+		if err := rows.Scan(fields...); err != nil {
+			log.Printf("Error scanning media row: %v", err)
+			return nil, err
+		}
+		setFileURLs(&item.File)
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over media: %v", err)
+		return nil, err
+	}
+
+	page := &models.MediaPage{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+		nextCursor := page.Items[limit-1].ID
+		page.NextCursor = &nextCursor
+	}
+
+	log.Printf("Fetched %d media items for chat %d", len(page.Items), chatID)
+	return page, nil
+}
+
+// DeleteExpiredFiles removes files past the retention period and uploads that
+// were never attached to a message. Thumbnails stay unattached and are kept as
+// long as their file exists. A zero retention keeps attached files forever.
+func (fs *fileService) DeleteExpiredFiles(ctx context.Context, retention, unattachedTTL time.Duration) (int64, error) {
+	expired := squirrel.Or{
+		squirrel.And{
+			squirrel.Eq{"message_id": nil},
+			squirrel.Expr("uploaded_at < NOW() - make_interval(secs => ?)", unattachedTTL.Seconds()),
+			squirrel.Expr("NOT EXISTS (SELECT 1 FROM files f WHERE f.thumbnail_file_id = files.id)"),
+		},
+	}
+	if retention > 0 {
+		expired = append(expired, squirrel.Expr("uploaded_at < NOW() - make_interval(secs => ?)", retention.Seconds()))
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Delete("files").
+		Where(expired)
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	result, err := db.Pool.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error deleting expired files: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Deleted %d expired files", result.RowsAffected())
+	return result.RowsAffected(), nil
+}
+
+// DeleteUnreferencedObjects removes storage objects that no file has referred
+// to for at least grace and returns their keys. The rows are deleted before
+// the blobs, so a concurrent upload can never be deduplicated against a blob
+// that is about to disappear.
+func (fs *fileService) DeleteUnreferencedObjects(ctx context.Context, grace time.Duration, limit int) ([]string, error) {
+	candidates := squirrel.Select("id").
+		From("storage_objects").
+		Where(squirrel.Eq{"ref_count": 0}).
+		Where(squirrel.Expr("unreferenced_at < NOW() - make_interval(secs => ?)", grace.Seconds())).
+		OrderBy("id").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	candidatesSQL, candidatesArgs, err := candidates.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Delete("storage_objects").
+		Where("id IN ("+candidatesSQL+")", candidatesArgs...).
+		Where(squirrel.Eq{"ref_count": 0}).
+		Suffix("RETURNING storage_key")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error deleting unreferenced storage objects: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			log.Printf("Error scanning storage key: %v", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over deleted storage objects: %v", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// insertFile has to run in a transaction: the upsert locks the storage object
+// until the new file refers to it, which keeps the GC away from it. Blobs are
+// only deduplicated against earlier uploads of the same user.
+func insertFile(ctx context.Context, q db.Querier, file *models.File) error {
+	objectQuery := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("storage_objects").
+		Columns("owner_id", "sha256", "storage_key", "size").
+		Values(file.UploaderID, nullIfEmpty(file.SHA256), file.StorageKey, file.Size).
+		Suffix("ON CONFLICT (owner_id, sha256) DO UPDATE SET sha256 = EXCLUDED.sha256 RETURNING id, storage_key")
+
+	sqlStr, args, err := objectQuery.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var objectID int
+	var storageKey string
+	if err := q.QueryRow(ctx, sqlStr, args...).Scan(&objectID, &storageKey); err != nil {
+		log.Printf("Error saving storage object %s: %v", file.StorageKey, err)
+		return err
+	}
+	if storageKey != file.StorageKey {
+		log.Printf("Blob %s duplicates storage object %d", file.StorageKey, objectID)
+		file.StorageKey = storageKey
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("files").
+		Columns("chat_id", "uploader_id", "file_name", "content_type", "media_type", "size", "storage_key", "object_id", "thumbnail_file_id").
+		Values(file.ChatID, file.UploaderID, file.FileName, file.ContentType, file.MediaType, file.Size, file.StorageKey, objectID, file.ThumbnailFileID).
+		Suffix("RETURNING id, uploaded_at")
+
+	sqlStr, args, err = query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	err = q.QueryRow(ctx, sqlStr, args...).Scan(&file.ID, &file.UploadedAt)
+	if err != nil {
+		log.Printf("Error saving file %s: %v", file.FileName, err)
+		return err
+	}
+
+	setFileURLs(file)
+	log.Printf("File %d (%d bytes) uploaded to chat %d by user %d", file.ID, file.Size, file.ChatID, file.UploaderID)
+	return nil
+}
+
+func FileURL(id int) string {
+	return fmt.Sprintf("/api/files/%d", id)
+}
+
+func scanFile(row pgx.Row) (*models.File, error) {
+	var file models.File
+	if err := row.Scan(fileFields(&file)...); err != nil {
+		return nil, err
+	}
+
+	setFileURLs(&file)
+	return &file, nil
+}
+
+// fileFields returns the scan targets matching fileColumns.
+func fileFields(file *models.File) []interface{} {
+	return []interface{}{
+		&file.ID, &file.MessageID, &file.ChatID, &file.UploaderID, &file.FileName, &file.ContentType,
+		&file.MediaType, &file.Size, &file.StorageKey, &file.UploadedAt, &file.ThumbnailFileID,
+	}
+}
+
+func setFileURLs(file *models.File) {
+	file.FileURL = FileURL(file.ID)
+	if file.ThumbnailFileID != nil {
+		file.ThumbnailURL = FileURL(*file.ThumbnailFileID)
+	}
+}
+
+// attachFiles links uploaded files to a message. Only unattached files that
+// the sender uploaded to the same chat can be attached.
+func attachFiles(ctx context.Context, q db.Querier, msg *models.Message, fileIDs []int) ([]models.File, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("files").
+		Set("message_id", msg.ID).
+		Where(squirrel.Eq{
+			"id":          fileIDs,
+			"chat_id":     msg.ChatID,
+			"uploader_id": msg.SenderID,
+			"message_id":  nil,
+		}).
+		Suffix("RETURNING " + strings.Join(fileColumns, ", "))
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := q.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error attaching files to message %d: %v", msg.ID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]models.File, 0, len(fileIDs))
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			log.Printf("Error scanning file row: %v", err)
+			return nil, err
+		}
+		files = append(files, *file)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over attached files: %v", err)
+		return nil, err
+	}
+
+	if len(files) != len(fileIDs) {
+		log.Printf("Only %d of %d files could be attached to message %d", len(files), len(fileIDs), msg.ID)
+		return nil, models.ErrFileNotFound
+	}
+
+	return files, nil
+}
+
+// copyForwardedFiles attaches copies of the source files to a forwarded
+// message. Every source names the chat and message its file has to be attached
+// to. The copies share the storage objects of the originals, so forwarding
+// never stores a blob twice, but they still count against the quotas of the
+// forwarder and the target chat.
+func copyForwardedFiles(ctx context.Context, tx pgx.Tx, msg *models.Message, sources []models.File, quotas []models.QuotaCheck) ([]models.File, error) {
+	files := make([]models.File, 0, len(sources))
+	for _, source := range sources {
+		original, err := getStoredFile(ctx, tx, squirrel.Eq{
+			"id":         source.ID,
+			"chat_id":    source.ChatID,
+			"message_id": source.MessageID,
+		})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				log.Printf("File %d is not attached to message %d", source.ID, *source.MessageID)
+				return nil, models.ErrFileNotFound
+			}
+			return nil, err
+		}
+
+		// The thumbnail is copied as well, otherwise members of the target
+		// chat could not download it.
+		var thumbnailID *int
+		if original.ThumbnailFileID != nil {
+			thumbnail, err := getStoredFile(ctx, tx, squirrel.Eq{"id": *original.ThumbnailFileID})
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return nil, err
+			}
+			if err == nil {
+				if err := reserveQuota(ctx, tx, quotas, thumbnail.Size); err != nil {
+					return nil, err
+				}
+				copied, err := copyFile(ctx, tx, thumbnail.ID, msg, nil, nil)
+				if err != nil {
+					return nil, err
+				}
+				thumbnailID = &copied.ID
+			}
+		}
+
+		if err := reserveQuota(ctx, tx, quotas, original.Size); err != nil {
+			return nil, err
+		}
+		file, err := copyFile(ctx, tx, original.ID, msg, &msg.ID, thumbnailID)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *file)
+	}
+
+	return files, nil
+}
+
+// getStoredFile loads a file whose blob is stored and keeps it from being
+// deleted until the transaction ends.
+func getStoredFile(ctx context.Context, q db.Querier, where squirrel.Eq) (*models.File, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select(fileColumns...).
+		From("files").
+		Where(where).
+		Where(squirrel.NotEq{"object_id": nil}).
+		Suffix("FOR SHARE")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	file, err := scanFile(q.QueryRow(ctx, sqlStr, args...))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error getting file %v: %v", where["id"], err)
+	}
+	return file, err
+}
+
+// copyFile inserts a file into the chat of msg that refers to the storage
+// object of an existing file.
+func copyFile(ctx context.Context, q db.Querier, sourceID int, msg *models.Message, messageID, thumbnailID *int) (*models.File, error) {
+	source := squirrel.Select().
+		Column("?::int", messageID).
+		Column("?::int", msg.ChatID).
+		Column("?::int", msg.SenderID).
+		Columns("file_name", "content_type", "media_type", "size", "storage_key", "object_id").
+		Column("?::int", thumbnailID).
+		From("files").
+		Where(squirrel.Eq{"id": sourceID}).
+		Where(squirrel.NotEq{"object_id": nil})
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("files").
+		Columns("message_id", "chat_id", "uploader_id", "file_name", "content_type", "media_type", "size", "storage_key", "object_id", "thumbnail_file_id").
+		Select(source).
+		Suffix("RETURNING " + strings.Join(fileColumns, ", "))
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	file, err := scanFile(q.QueryRow(ctx, sqlStr, args...))
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Error copying file %d to chat %d: %v", sourceID, msg.ChatID, err)
+		}
+		return nil, err
+	}
+
+	log.Printf("File %d copied to chat %d as file %d", sourceID, msg.ChatID, file.ID)
+	return file, nil
+}
+
+// setMessageFiles attaches file metadata to the given messages.
+func setMessageFiles(ctx context.Context, q db.Querier, messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	messageIDs := make([]int, 0, len(messages))
+	index := make(map[int]int, len(messages))
+	for i, msg := range messages {
+		messageIDs = append(messageIDs, msg.ID)
+		index[msg.ID] = i
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select(fileColumns...).
+		From("files").
+		Where(squirrel.Eq{"message_id": messageIDs}).
+		Where(squirrel.NotEq{"storage_key": nil}).
+		OrderBy("id ASC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := q.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting message files: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			log.Printf("Error scanning file row: %v", err)
+			return err
+		}
+		i := index[*file.MessageID]
+		messages[i].Files = append(messages[i].Files, *file)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over message files: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"SecureMessenger/server/internal/db"
+	"SecureMessenger/server/internal/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+)
+
+type PresenceService interface {
+	UpdateLastSeen(ctx context.Context, userID int) (time.Time, string, error)
+	GetPresence(ctx context.Context, viewerID, userID int) (*models.Presence, error)
+	GetLastSeenVisibility(ctx context.Context, userID int) (string, error)
+	SetLastSeenVisibility(ctx context.Context, userID int, visibility string) error
+}
+
+type presenceService struct{}
+
+func NewPresenceService() PresenceService {
+	return &presenceService{}
+}
+
+func (ps *presenceService) UpdateLastSeen(ctx context.Context, userID int) (time.Time, string, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("users").
+		Set("last_seen_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": userID}).
+		Suffix("RETURNING last_seen_at, last_seen_visibility")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return time.Time{}, "", err
+	}
+
+	var lastSeenAt time.Time
+	var visibility string
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&lastSeenAt, &visibility)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, "", models.ErrUserNotFound
+		}
+		log.Printf("Error updating last seen of user %d: %v", userID, err)
+		return time.Time{}, "", err
+	}
+
+	return lastSeenAt, visibility, nil
+}
+
+func (ps *presenceService) GetPresence(ctx context.Context, viewerID, userID int) (*models.Presence, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("u.last_seen_at", "u.last_seen_visibility").
+		Column(squirrel.Expr(`EXISTS (
+			SELECT 1 FROM chat_participants a
+			JOIN chat_participants b ON b.chat_id = a.chat_id
+			WHERE a.user_id = u.id AND b.user_id = ?
+		)`, viewerID)).
+		From("users u").
+		Where(squirrel.Eq{"u.id": userID})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var lastSeenAt sql.NullTime
+	var visibility string
+	var isContact bool
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&lastSeenAt, &visibility, &isContact)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("User %d not found", userID)
+			return nil, models.ErrUserNotFound
+		}
+		log.Printf("Error getting presence of user %d: %v", userID, err)
+		return nil, err
+	}
+
+	presence := &models.Presence{UserID: userID}
+
+	presence.Visible = viewerID == userID ||
+		visibility == models.LastSeenEveryone ||
+		(visibility == models.LastSeenContacts && isContact)
+	if presence.Visible && lastSeenAt.Valid {
+		presence.LastSeenAt = &lastSeenAt.Time
+	}
+
+	return presence, nil
+}
+
+func (ps *presenceService) GetLastSeenVisibility(ctx context.Context, userID int) (string, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("last_seen_visibility").
+		From("users").
+		Where(squirrel.Eq{"id": userID})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return "", err
+	}
+
+	var visibility string
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&visibility)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", models.ErrUserNotFound
+		}
+		log.Printf("Error getting last seen visibility of user %d: %v", userID, err)
+		return "", err
+	}
+
+	return visibility, nil
+}
+
+func (ps *presenceService) SetLastSeenVisibility(ctx context.Context, userID int, visibility string) error {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("users").
+		Set("last_seen_visibility", visibility).
+		Where(squirrel.Eq{"id": userID})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	result, err := db.Pool.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error updating last seen visibility of user %d: %v", userID, err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return models.ErrUserNotFound
+	}
+
+	log.Printf("Last seen visibility of user %d set to %s", userID, visibility)
+	return nil
+}
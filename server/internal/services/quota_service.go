@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"SecureMessenger/server/internal/db"
+	"SecureMessenger/server/internal/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+)
+
+type quotaTarget struct {
+	table        string
+	column       string
+	filesColumn  string
+	uploadColumn string
+	lockClass    int32
+}
+
+var quotaTargets = map[string]quotaTarget{
+	models.QuotaScopeUser: {table: "user_storage_quotas", column: "user_id", filesColumn: "uploader_id", uploadColumn: "user_id", lockClass: 1},
+	models.QuotaScopeChat: {table: "chat_storage_quotas", column: "chat_id", filesColumn: "chat_id", uploadColumn: "chat_id", lockClass: 2},
+}
+
+type QuotaService interface {
+	GetUsage(ctx context.Context, scope string, targetID int) (models.StorageUsage, error)
+	GetUserUsageByChat(ctx context.Context, userID int) ([]models.ChatStorageUsage, error)
+	GetQuotaOverride(ctx context.Context, scope string, targetID int) (*models.QuotaOverride, error)
+	SetQuotaOverride(ctx context.Context, scope string, targetID int, override *models.QuotaOverride) error
+	DeleteQuotaOverride(ctx context.Context, scope string, targetID int) error
+}
+
+type quotaService struct{}
+
+func NewQuotaService() QuotaService {
+	return &quotaService{}
+}
+
+// GetUsage counts stored files and the declared size of resumable uploads
+// that are still in progress.
+func (qs *quotaService) GetUsage(ctx context.Context, scope string, targetID int) (models.StorageUsage, error) {
+	return getUsage(ctx, db.Pool, scope, targetID)
+}
+
+func getUsage(ctx context.Context, q db.Querier, scope string, targetID int) (models.StorageUsage, error) {
+	target, err := getQuotaTarget(scope)
+	if err != nil {
+		return models.StorageUsage{}, err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("COALESCE(SUM(size), 0)", "COUNT(*)").
+		FromSelect(usageRows(target, targetID), "stored")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return models.StorageUsage{}, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var usage models.StorageUsage
+	if err := q.QueryRow(ctx, sqlStr, args...).Scan(&usage.Bytes, &usage.Files); err != nil {
+		log.Printf("Error getting storage usage of %s %d: %v", scope, targetID, err)
+		return models.StorageUsage{}, err
+	}
+
+	return usage, nil
+}
+
+func (qs *quotaService) GetUserUsageByChat(ctx context.Context, userID int) ([]models.ChatStorageUsage, error) {
+	target := quotaTargets[models.QuotaScopeUser]
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("c.id", "c.type", "c.name", "COALESCE(SUM(stored.size), 0)", "COUNT(*)").
+		FromSelect(usageRows(target, userID), "stored").
+		Join("chats c ON c.id = stored.chat_id").
+		GroupBy("c.id", "c.type", "c.name").
+		OrderBy("COALESCE(SUM(stored.size), 0) DESC", "c.id ASC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting storage usage of user %d by chat: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	chats := make([]models.ChatStorageUsage, 0)
+	for rows.Next() {
+		var chat models.ChatStorageUsage
+		if err := rows.Scan(&chat.ChatID, &chat.ChatType, &chat.ChatName, &chat.Bytes, &chat.Files); err != nil {
+			log.Printf("Error scanning chat storage usage: %v", err)
+			return nil, err
+		}
+		chats = append(chats, chat)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over chat storage usage: %v", err)
+		return nil, err
+	}
+
+	return chats, nil
+}
+
+// GetQuotaOverride returns nil when no override is set.
+func (qs *quotaService) GetQuotaOverride(ctx context.Context, scope string, targetID int) (*models.QuotaOverride, error) {
+	target, err := getQuotaTarget(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("max_bytes", "max_files", "updated_by", "updated_at").
+		From(target.table).
+		Where(squirrel.Eq{target.column: targetID})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	var override models.QuotaOverride
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&override.MaxBytes, &override.MaxFiles, &override.UpdatedBy, &override.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		log.Printf("Error getting quota override of %s %d: %v", scope, targetID, err)
+		return nil, err
+	}
+
+	return &override, nil
+}
+
+func (qs *quotaService) SetQuotaOverride(ctx context.Context, scope string, targetID int, override *models.QuotaOverride) error {
+	target, err := getQuotaTarget(scope)
+	if err != nil {
+		return err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert(target.table).
+		Columns(target.column, "max_bytes", "max_files", "updated_by").
+		Values(targetID, override.MaxBytes, override.MaxFiles, override.UpdatedBy).
+		Suffix("ON CONFLICT (" + target.column + ") DO UPDATE SET " +
+			"max_bytes = EXCLUDED.max_bytes, max_files = EXCLUDED.max_files, " +
+			"updated_by = EXCLUDED.updated_by, updated_at = NOW() " +
+			"RETURNING updated_at")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	if err := db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&override.UpdatedAt); err != nil {
+		log.Printf("Error setting quota override of %s %d: %v", scope, targetID, err)
+		return err
+	}
+
+	log.Printf("Quota override of %s %d set to %v bytes, %v files", scope, targetID, override.MaxBytes, override.MaxFiles)
+	return nil
+}
+
+func (qs *quotaService) DeleteQuotaOverride(ctx context.Context, scope string, targetID int) error {
+	target, err := getQuotaTarget(scope)
+	if err != nil {
+		return err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Delete(target.table).
+		Where(squirrel.Eq{target.column: targetID})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	if _, err := db.Pool.Exec(ctx, sqlStr, args...); err != nil {
+		log.Printf("Error deleting quota override of %s %d: %v", scope, targetID, err)
+		return err
+	}
+
+	log.Printf("Quota override of %s %d removed", scope, targetID)
+	return nil
+}
+
+// reserveQuota checks a new file of the given size against the quotas in the
+// transaction that stores it. Each user and chat is locked until the
+// transaction ends, so parallel uploads cannot overshoot a quota together.
+// Callers pass the user before the chat to keep the lock order fixed.
+func reserveQuota(ctx context.Context, tx pgx.Tx, checks []models.QuotaCheck, size int64) error {
+	for _, check := range checks {
+		target, err := getQuotaTarget(check.Scope)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1, $2)", target.lockClass, check.TargetID); err != nil {
+			log.Printf("Error locking storage quota of %s %d: %v", check.Scope, check.TargetID, err)
+			return err
+		}
+
+		usage, err := getUsage(ctx, tx, check.Scope, check.TargetID)
+		if err != nil {
+			return err
+		}
+
+		if err := check.Quota.Check(check.Scope, usage, size, 1); err != nil {
+			log.Printf("File of %d bytes rejected for %s %d: %v", size, check.Scope, check.TargetID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func getQuotaTarget(scope string) (quotaTarget, error) {
+	target, ok := quotaTargets[scope]
+	if !ok {
+		return quotaTarget{}, fmt.Errorf("unknown quota scope %q", scope)
+	}
+	return target, nil
+}
+
+// usageRows selects the chat and size of every stored file and pending
+// upload that counts against the target.
+func usageRows(target quotaTarget, targetID int) squirrel.SelectBuilder {
+	return squirrel.Select("chat_id", "size").
+		From("files").
+		Where(squirrel.Eq{target.filesColumn: targetID}).
+		Where(squirrel.NotEq{"storage_key": nil}).
+		Suffix("UNION ALL SELECT chat_id, length FROM uploads WHERE "+target.uploadColumn+" = ? AND file_id IS NULL AND expires_at > NOW()", targetID)
+}
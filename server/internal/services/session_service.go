@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"SecureMessenger/server/internal/db"
+	"SecureMessenger/server/internal/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+)
+
+type SessionService interface {
+	CreateSession(ctx context.Context, userID int, device models.DeviceInfo) (*models.Session, error)
+	ValidateSession(ctx context.Context, jti string, userID int) (*models.Session, error)
+	GetSessionsByUserId(ctx context.Context, userID int) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID int) error
+	RevokeAllSessions(ctx context.Context, userID int) ([]int, error)
+}
+
+// sessionTouchInterval is how stale last_seen_at may get before a validated
+// session updates it.
+const sessionTouchInterval = time.Minute
+
+type sessionService struct{}
+
+func NewSessionService() SessionService {
+	return &sessionService{}
+}
+
+func (ss *sessionService) CreateSession(ctx context.Context, userID int, device models.DeviceInfo) (*models.Session, error) {
+	jti, err := generateRandomToken(24)
+	if err != nil {
+		log.Printf("Error generating session ID for user %d: %v", userID, err)
+		return nil, err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("sessions").
+		Columns("user_id", "jti", "device_name", "user_agent", "ip_address").
+		Values(userID, jti, device.DeviceName, device.UserAgent, device.IPAddress).
+		Suffix("RETURNING id, created_at, last_seen_at")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	session := models.Session{
+		UserID:     userID,
+		JTI:        jti,
+		DeviceName: device.DeviceName,
+		UserAgent:  device.UserAgent,
+		IPAddress:  device.IPAddress,
+	}
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		log.Printf("Error creating session for user %d: %v", userID, err)
+		return nil, err
+	}
+
+	log.Printf("Session %d created for user %d", session.ID, userID)
+	return &session, nil
+}
+
+// ValidateSession returns the active session with the given token ID. The
+// last_seen_at column is written at most once per sessionTouchInterval, so
+// authenticated requests do not update the row every time.
+func (ss *sessionService) ValidateSession(ctx context.Context, jti string, userID int) (*models.Session, error) {
+	sqlStr := `WITH session AS (
+		SELECT id, user_id, COALESCE(device_name, '') AS device_name, COALESCE(user_agent, '') AS user_agent,
+			COALESCE(ip_address, '') AS ip_address, created_at, last_seen_at
+		FROM sessions
+		WHERE jti = $1 AND user_id = $2 AND revoked_at IS NULL
+	), touched AS (
+		UPDATE sessions s
+		SET last_seen_at = NOW()
+		FROM session
+		WHERE s.id = session.id AND s.last_seen_at < NOW() - make_interval(secs => $3)
+		RETURNING s.last_seen_at
+	)
+	SELECT id, user_id, device_name, user_agent, ip_address, created_at,
+		COALESCE((SELECT last_seen_at FROM touched), last_seen_at)
+	FROM session`
+
+	var session models.Session
+	err := db.Pool.QueryRow(ctx, sqlStr, jti, userID, sessionTouchInterval.Seconds()).Scan(
+		&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastSeenAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("No active session found for user %d", userID)
+			return nil, models.ErrSessionNotFound
+		}
+		log.Printf("Error validating session for user %d: %v", userID, err)
+		return nil, err
+	}
+
+	session.JTI = jti
+	return &session, nil
+}
+
+func (ss *sessionService) GetSessionsByUserId(ctx context.Context, userID int) ([]models.Session, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("id", "user_id", "device_name", "user_agent", "ip_address", "created_at", "last_seen_at").
+		From("sessions").
+		Where(squirrel.Eq{
+			"user_id":    userID,
+			"revoked_at": nil,
+		}).
+		OrderBy("last_seen_at DESC")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error getting sessions for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]models.Session, 0)
+	for rows.Next() {
+		var session models.Session
+		var deviceName, userAgent, ipAddress sql.NullString
+		err := rows.Scan(&session.ID, &session.UserID, &deviceName, &userAgent, &ipAddress, &session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			log.Printf("Error scanning session row: %v", err)
+			continue
+		}
+		session.DeviceName = deviceName.String
+		session.UserAgent = userAgent.String
+		session.IPAddress = ipAddress.String
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over sessions: %v", err)
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (ss *sessionService) RevokeSession(ctx context.Context, userID, sessionID int) error {
+	revoked, err := revokeSessions(ctx, squirrel.Eq{"id": sessionID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if len(revoked) == 0 {
+		log.Printf("Active session %d not found for user %d", sessionID, userID)
+		return models.ErrSessionNotFound
+	}
+
+	log.Printf("Session %d of user %d revoked", sessionID, userID)
+	return nil
+}
+
+func (ss *sessionService) RevokeAllSessions(ctx context.Context, userID int) ([]int, error) {
+	revoked, err := revokeSessions(ctx, squirrel.Eq{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Revoked %d sessions of user %d", len(revoked), userID)
+	return revoked, nil
+}
+
+func revokeSessions(ctx context.Context, where squirrel.Eq) ([]int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("sessions").
+		Set("revoked_at", squirrel.Expr("NOW()")).
+		Where(where).
+		Where(squirrel.Eq{"revoked_at": nil}).
+		Suffix("RETURNING id")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	rows, err := tx.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+		return nil, err
+	}
+
+	var sessionIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Printf("Error scanning session ID: %v", err)
+			return nil, err
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over revoked sessions: %v", err)
+		return nil, err
+	}
+
+	if len(sessionIDs) > 0 {
+		if err := revokeTokens(ctx, tx, squirrel.Eq{"session_id": sessionIDs}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	return sessionIDs, nil
+}
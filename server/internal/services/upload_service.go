@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"SecureMessenger/server/internal/db"
+	"SecureMessenger/server/internal/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+)
+
+type UploadService interface {
+	CreateUpload(ctx context.Context, upload *models.Upload, ttl time.Duration, quotas []models.QuotaCheck) error
+	GetUpload(ctx context.Context, id string, userID int) (*models.Upload, error)
+	AppendUpload(ctx context.Context, id string, userID int, ttl, lease time.Duration, write func(upload *models.Upload) (int64, error)) (*models.Upload, error)
+	CompleteUpload(ctx context.Context, upload *models.Upload, storageKey, sha256 string) (*models.File, error)
+	DeleteUpload(ctx context.Context, id string, userID int) error
+	DeleteExpiredUploads(ctx context.Context) ([]string, error)
+}
+
+type uploadService struct{}
+
+func NewUploadService() UploadService {
+	return &uploadService{}
+}
+
+// CreateUpload reserves the declared length of a resumable upload against the
+// given quotas until it completes or expires.
+func (us *uploadService) CreateUpload(ctx context.Context, upload *models.Upload, ttl time.Duration, quotas []models.QuotaCheck) error {
+	id, err := generateRandomToken(16)
+	if err != nil {
+		log.Printf("Error generating upload ID for user %d: %v", upload.UserID, err)
+		return err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := reserveQuota(ctx, tx, quotas, upload.Length); err != nil {
+		return err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Insert("uploads").
+		Columns("id", "user_id", "chat_id", "file_name", "content_type", "media_type", "thumbnail_file_id", "length", "expires_at").
+		Values(id, upload.UserID, upload.ChatID, upload.FileName, upload.ContentType, upload.MediaType, upload.ThumbnailID, upload.Length,
+			squirrel.Expr("NOW() + make_interval(secs => ?)", ttl.Seconds())).
+		Suffix("RETURNING created_at, expires_at")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	err = tx.QueryRow(ctx, sqlStr, args...).Scan(&upload.CreatedAt, &upload.ExpiresAt)
+	if err != nil {
+		log.Printf("Error creating upload for user %d: %v", upload.UserID, err)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return err
+	}
+
+	upload.ID = id
+	log.Printf("Upload %s of %d bytes created for chat %d by user %d", upload.ID, upload.Length, upload.ChatID, upload.UserID)
+	return nil
+}
+
+func (us *uploadService) GetUpload(ctx context.Context, id string, userID int) (*models.Upload, error) {
+	return getUpload(ctx, db.Pool, id, userID)
+}
+
+// AppendUpload leases the upload while write stores the next chunk, so
+// requests for the same upload on different replicas cannot write the same
+// chunk at once. No transaction is open while the chunk streams in; the lease
+// expires by itself after lease if the server dies before releasing it.
+// Afterwards the offset is advanced by the number of bytes write reports, and
+// the expiry is pushed back since the client is still active. Errors from
+// write are returned as they are.
+func (us *uploadService) AppendUpload(ctx context.Context, id string, userID int, ttl, lease time.Duration, write func(upload *models.Upload) (int64, error)) (*models.Upload, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("uploads").
+		Set("locked_until", squirrel.Expr("NOW() + make_interval(secs => ?)", lease.Seconds())).
+		Where(squirrel.Eq{
+			"id":      id,
+			"user_id": userID,
+		}).
+		Where("expires_at > NOW()").
+		Where("(locked_until IS NULL OR locked_until < NOW())").
+		Suffix("RETURNING " + strings.Join(uploadColumns, ", "))
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	upload, err := scanUpload(db.Pool.QueryRow(ctx, sqlStr, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, uploadUnavailable(ctx, id, userID)
+		}
+		log.Printf("Error leasing upload %s: %v", id, err)
+		return nil, err
+	}
+
+	written, writeErr := write(upload)
+
+	// The staged bytes are kept even if the client went away, so the offset
+	// has to be recorded regardless of the request context.
+	if err := releaseUpload(context.WithoutCancel(ctx), upload, max(written, 0), ttl); err != nil {
+		return nil, err
+	}
+
+	return upload, writeErr
+}
+
+// releaseUpload ends the lease of an upload and advances its offset by
+// written bytes.
+func releaseUpload(ctx context.Context, upload *models.Upload, written int64, ttl time.Duration) error {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("uploads").
+		Set("upload_offset", squirrel.Expr("upload_offset + ?", written)).
+		Set("expires_at", squirrel.Expr("NOW() + make_interval(secs => ?)", ttl.Seconds())).
+		Set("locked_until", nil).
+		Where(squirrel.Eq{
+			"id":            upload.ID,
+			"upload_offset": upload.Offset,
+		}).
+		Where("upload_offset + ? <= length", written).
+		Suffix("RETURNING upload_offset, expires_at")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&upload.Offset, &upload.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Upload %s cannot take %d more bytes at offset %d", upload.ID, written, upload.Offset)
+			return models.ErrUploadConflict
+		}
+		log.Printf("Error advancing upload %s: %v", upload.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+// CompleteUpload creates the files row for a fully received upload whose blob
+// was stored under storageKey. Like CreateFile, it may point the file at an
+// existing storage object with the same hash instead.
+func (us *uploadService) CompleteUpload(ctx context.Context, upload *models.Upload, storageKey, sha256 string) (*models.File, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	file := &models.File{
+		ChatID:          upload.ChatID,
+		UploaderID:      upload.UserID,
+		FileName:        upload.FileName,
+		ContentType:     upload.ContentType,
+		MediaType:       upload.MediaType,
+		Size:            upload.Length,
+		StorageKey:      storageKey,
+		SHA256:          sha256,
+		ThumbnailFileID: upload.ThumbnailID,
+	}
+	if err := insertFile(ctx, tx, file); err != nil {
+		return nil, err
+	}
+
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Update("uploads").
+		Set("file_id", file.ID).
+		Where(squirrel.Eq{
+			"id":      upload.ID,
+			"file_id": nil,
+		}).
+		Where("upload_offset = length")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	result, err := tx.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error completing upload %s: %v", upload.ID, err)
+		return nil, err
+	}
+	if result.RowsAffected() == 0 {
+		log.Printf("Upload %s is not pending completion", upload.ID)
+		return nil, models.ErrUploadConflict
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	upload.FileID = &file.ID
+	log.Printf("Upload %s completed as file %d", upload.ID, file.ID)
+	return file, nil
+}
+
+// DeleteUpload fails with ErrUploadLocked while a chunk is being received.
+func (us *uploadService) DeleteUpload(ctx context.Context, id string, userID int) error {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Delete("uploads").
+		Where(squirrel.Eq{
+			"id":      id,
+			"user_id": userID,
+		}).
+		Where("expires_at > NOW()").
+		Where("(locked_until IS NULL OR locked_until < NOW())")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	result, err := db.Pool.Exec(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error deleting upload %s: %v", id, err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return uploadUnavailable(ctx, id, userID)
+	}
+
+	log.Printf("Upload %s of user %d terminated", id, userID)
+	return nil
+}
+
+// DeleteExpiredUploads removes uploads past their expiry and returns their
+// IDs so the staged bytes can be cleaned up.
+func (us *uploadService) DeleteExpiredUploads(ctx context.Context) ([]string, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Delete("uploads").
+		Where("expires_at <= NOW()").
+		Suffix("RETURNING id")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		log.Printf("Error deleting expired uploads: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("Error scanning upload ID: %v", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over expired uploads: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Deleted %d expired uploads", len(ids))
+	return ids, nil
+}
+
+var uploadColumns = []string{"id", "user_id", "chat_id", "file_name", "content_type", "media_type", "thumbnail_file_id", "length", "upload_offset", "file_id", "created_at", "expires_at"}
+
+// getUpload loads an upload that has not expired.
+func getUpload(ctx context.Context, q db.Querier, id string, userID int) (*models.Upload, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select(uploadColumns...).
+		From("uploads").
+		Where(squirrel.Eq{
+			"id":      id,
+			"user_id": userID,
+		}).
+		Where("expires_at > NOW()")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Executing SQL: %s, Args: %v", sqlStr, args)
+
+	upload, err := scanUpload(q.QueryRow(ctx, sqlStr, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Upload %s not found for user %d", id, userID)
+			return nil, models.ErrUploadNotFound
+		}
+		log.Printf("Error getting upload %s: %v", id, err)
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// uploadUnavailable explains why an upload could not be leased or deleted.
+func uploadUnavailable(ctx context.Context, id string, userID int) error {
+	if _, err := getUpload(ctx, db.Pool, id, userID); err != nil {
+		return err
+	}
+	log.Printf("Upload %s is leased by another request", id)
+	return models.ErrUploadLocked
+}
+
+func scanUpload(row pgx.Row) (*models.Upload, error) {
+	var upload models.Upload
+	err := row.Scan(
+		&upload.ID, &upload.UserID, &upload.ChatID, &upload.FileName, &upload.ContentType, &upload.MediaType, &upload.ThumbnailID,
+		&upload.Length, &upload.Offset, &upload.FileID, &upload.CreatedAt, &upload.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
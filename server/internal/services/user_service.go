@@ -14,6 +14,7 @@ import (
 
 	"github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx"
+	pgxv4 "github.com/jackc/pgx/v4"
 )
 
 type UserService interface {
@@ -32,6 +33,7 @@ type UserService interface {
 	GetUserPublicKey(ctx context.Context, userID int) (string, error)
 	GetUserIDsByEmails(ctx context.Context, emails []string) ([]int, error)
 	GetUsersByEmails(ctx context.Context, emails []string) ([]*models.User, error)
+	IsAdmin(ctx context.Context, userID int) (bool, error)
 }
 
 type userService struct{}
@@ -578,3 +580,28 @@ func (us *userService) GetUsersByEmails(ctx context.Context, emails []string) ([
 	log.Printf("Fetched %d users for emails: %v", len(users), emails)
 	return users, nil
 }
+
+func (us *userService) IsAdmin(ctx context.Context, userID int) (bool, error) {
+	query := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).
+		Select("is_admin").
+		From("users").
+		Where(squirrel.Eq{"id": userID})
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		log.Printf("Failed to build SQL query: %v", err)
+		return false, err
+	}
+
+	var isAdmin bool
+	err = db.Pool.QueryRow(ctx, sqlStr, args...).Scan(&isAdmin)
+	if err != nil {
+		if errors.Is(err, pgxv4.ErrNoRows) {
+			return false, models.ErrUserNotFound
+		}
+		log.Printf("Error checking admin flag of user %d: %v", userID, err)
+		return false, err
+	}
+
+	return isAdmin, nil
+}
@@ -0,0 +1,448 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	minPartSize     = 5 << 20
+)
+
+type S3Config struct {
+	// Endpoint is used by the server itself, PublicEndpoint is put into
+	// presigned URLs handed out to clients. They differ when the object
+	// store is reached through an internal network.
+	Endpoint       string
+	PublicEndpoint string
+	Region         string
+	Bucket         string
+	AccessKey      string
+	SecretKey      string
+	PathStyle      bool
+	PartSize       int64
+	PresignExpiry  time.Duration
+}
+
+// S3Storage talks to S3-compatible object stores (AWS S3, MinIO) using
+// requests signed with AWS Signature Version 4.
+type S3Storage struct {
+	cfg      S3Config
+	endpoint *url.URL
+	public   *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3 bucket and credentials are required")
+	}
+	if cfg.PartSize < minPartSize {
+		return nil, fmt.Errorf("S3 part size must be at least %d bytes", minPartSize)
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+
+	public := endpoint
+	if cfg.PublicEndpoint != "" {
+		public, err = url.Parse(cfg.PublicEndpoint)
+		if err != nil || public.Host == "" {
+			return nil, fmt.Errorf("invalid S3 public endpoint %q", cfg.PublicEndpoint)
+		}
+	}
+
+	return &S3Storage{
+		cfg:      cfg,
+		endpoint: endpoint,
+		public:   public,
+		client:   &http.Client{},
+		now:      time.Now,
+	}, nil
+}
+
+// Put uploads objects up to the part size in a single request and switches
+// to a multipart upload for larger or unknown sizes, so memory use stays
+// bounded by one part.
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (int64, error) {
+	if size >= 0 && size <= s.cfg.PartSize {
+		return s.putObject(ctx, key, r, size, contentType)
+	}
+
+	buf := make([]byte, s.cfg.PartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.putObject(ctx, key, bytes.NewReader(buf[:n]), int64(n), contentType)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	uploadID, err := s.createMultipartUpload(ctx, key, contentType)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := s.uploadParts(ctx, key, uploadID, r, buf)
+	if err != nil {
+		if abortErr := s.abortMultipartUpload(ctx, key, uploadID); abortErr != nil {
+			log.Printf("Error aborting multipart upload of %s: %v", key, abortErr)
+		}
+		return written, err
+	}
+	return written, nil
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (int64, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, -1, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, -1, nil)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PresignGet returns a short-lived URL that lets the holder download the
+// object directly from the object store.
+func (s *S3Storage) PresignGet(key, fileName, contentType string) (string, error) {
+	amzDate := s.now().UTC().Format(amzDateFormat)
+	scope := s.scope(amzDate)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(s.cfg.PresignExpiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if contentType != "" {
+		query.Set("response-content-type", contentType)
+	}
+	if fileName != "" {
+		query.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	}
+
+	host, path := s.location(s.public, key)
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		path,
+		canonicalQuery,
+		"host:" + host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	signature := s.signature(amzDate, canonicalRequest)
+	return s.public.Scheme + "://" + host + path + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+func (s *S3Storage) putObject(ctx context.Context, key string, r io.Reader, size int64, contentType string) (int64, error) {
+	counter := &countingReader{r: r}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, counter, size, header)
+	if err != nil {
+		return counter.n, err
+	}
+	resp.Body.Close()
+	return counter.n, nil
+}
+
+func (s *S3Storage) createMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, -1, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decoding multipart upload of %s: %w", key, err)
+	}
+	return result.UploadID, nil
+}
+
+// uploadParts sends buf, which already holds the first part, and then the
+// rest of r part by part.
+func (s *S3Storage) uploadParts(ctx context.Context, key, uploadID string, r io.Reader, buf []byte) (int64, error) {
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+
+	var parts []completedPart
+	var written int64
+	n := len(buf)
+	for partNumber := 1; n > 0; partNumber++ {
+		query := url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {uploadID},
+		}
+		resp, err := s.do(ctx, http.MethodPut, key, query, bytes.NewReader(buf[:n]), int64(n), nil)
+		if err != nil {
+			return written, err
+		}
+		resp.Body.Close()
+
+		parts = append(parts, completedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+		written += int64(n)
+
+		n, err = io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return written, err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return written, err
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body), int64(len(body)), nil)
+	if err != nil {
+		return written, err
+	}
+	defer resp.Body.Close()
+
+	// CompleteMultipartUpload can fail after the 200 status was sent.
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return written, err
+	}
+	if err := parseS3Error(respBody); err != nil {
+		return written, fmt.Errorf("completing multipart upload of %s: %w", key, err)
+	}
+
+	log.Printf("Stored %s in %d parts (%d bytes)", key, len(parts), written)
+	return written, nil
+}
+
+func (s *S3Storage) abortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for key and turns error responses into errors.
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	host, path := s.location(s.endpoint, key)
+	canonicalQuery := canonicalQueryString(query)
+
+	rawURL := s.endpoint.Scheme + "://" + host + path
+	if canonicalQuery != "" {
+		rawURL += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if size >= 0 {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+
+	s.sign(req, host, path, canonicalQuery, unsignedPayload)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := parseS3Error(respBody); err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %s: %w", method, key, resp.Status, err)
+	}
+	return nil, fmt.Errorf("s3 %s %s: %s", method, key, resp.Status)
+}
+
+// location returns the host and the URI-encoded path of key, using either
+// path-style (host/bucket/key) or virtual-hosted-style (bucket.host/key)
+// addressing.
+func (s *S3Storage) location(endpoint *url.URL, key string) (string, string) {
+	path := "/" + uriEncode(key, false)
+	if s.cfg.PathStyle {
+		return endpoint.Host, "/" + uriEncode(s.cfg.Bucket, true) + path
+	}
+	return s.cfg.Bucket + "." + endpoint.Host, path
+}
+
+// sign adds the date, payload hash and Authorization headers to req. All
+// headers already set on req are signed along with the host.
+func (s *S3Storage) sign(req *http.Request, host, path, canonicalQuery, payloadHash string) {
+	amzDate := s.now().UTC().Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := []string{"host"}
+	values := map[string]string{"host": host}
+	for name, headerValues := range req.Header {
+		name = strings.ToLower(name)
+		names = append(names, name)
+		values[name] = strings.Join(strings.Fields(strings.Join(headerValues, ",")), " ")
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, s.scope(amzDate), signedHeaders, s.signature(amzDate, canonicalRequest)))
+}
+
+func (s *S3Storage) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3Storage) signature(amzDate, canonicalRequest string) string {
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + s.scope(amzDate) + "\n" + hex.EncodeToString(hashedRequest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes everything except the unreserved characters, as required
+// for the canonical request of Signature Version 4.
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func parseS3Error(body []byte) error {
+	var s3Err struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}
+	if err := xml.Unmarshal(body, &s3Err); err != nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", s3Err.Code, s3Err.Message)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
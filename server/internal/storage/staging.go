@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"SecureMessenger/server/internal/config"
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Staging keeps the bytes of unfinished resumable uploads until the last
+// chunk arrives and the blob can be moved to Storage.
+type Staging interface {
+	// Append writes r to the upload starting at offset and returns the number
+	// of bytes that were kept, so the caller can record partial progress.
+	// Callers must not append to the same upload concurrently.
+	Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	Remove(ctx context.Context, id string) error
+}
+
+// NewStagingFromConfig stages uploads next to the blobs: on local disk for
+// the local backend and as objects in the shared store otherwise, so that
+// any replica can accept the next chunk.
+func NewStagingFromConfig(store Storage) (Staging, error) {
+	if _, ok := store.(*LocalStorage); ok {
+		return NewLocalStaging(config.GetString("STORAGE_UPLOAD_PATH", "./data/uploads"))
+	}
+	return NewObjectStaging(store), nil
+}
+
+type LocalStaging struct {
+	root string
+}
+
+func NewLocalStaging(root string) (*LocalStaging, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("creating staging directory %s: %w", root, err)
+	}
+	return &LocalStaging{root: root}, nil
+}
+
+// Append discards bytes past offset left behind by an interrupted request
+// before writing.
+func (s *LocalStaging) Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o640)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < offset {
+		return 0, fmt.Errorf("staged upload %s has %d bytes, expected at least %d", id, info.Size(), offset)
+	}
+	if err := file.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	written, copyErr := io.Copy(file, r)
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+	return written, copyErr
+}
+
+func (s *LocalStaging) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *LocalStaging) Remove(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStaging) path(id string) (string, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid upload ID %q", id)
+	}
+	return filepath.Join(s.root, id), nil
+}
+
+// ObjectStaging stores every received chunk as its own object keyed by its
+// offset. The chunk at offset o is followed by the one at o plus its size, so
+// the upload can be read back without keeping a list of chunks. A failed
+// chunk is dropped as a whole and the client resumes from the old offset.
+type ObjectStaging struct {
+	store Storage
+}
+
+func NewObjectStaging(store Storage) *ObjectStaging {
+	return &ObjectStaging{store: store}
+}
+
+func (s *ObjectStaging) Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	key, err := chunkKey(id, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := s.store.Put(ctx, key, r, -1, "application/octet-stream")
+	if err != nil || written == 0 {
+		if deleteErr := s.store.Delete(ctx, key); deleteErr != nil {
+			return 0, deleteErr
+		}
+		return 0, err
+	}
+	return written, nil
+}
+
+func (s *ObjectStaging) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid upload ID %q", id)
+	}
+	return &chunkReader{ctx: ctx, store: s.store, id: id}, nil
+}
+
+func (s *ObjectStaging) Remove(ctx context.Context, id string) error {
+	var offset int64
+	for {
+		key, err := chunkKey(id, offset)
+		if err != nil {
+			return err
+		}
+
+		size, err := s.store.Stat(ctx, key)
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.store.Delete(ctx, key); err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		offset += size
+	}
+}
+
+func chunkKey(id string, offset int64) (string, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid upload ID %q", id)
+	}
+	return fmt.Sprintf("uploads/%s/%020d", id, offset), nil
+}
+
+// chunkReader reads the chunks of an ObjectStaging upload one after another.
+type chunkReader struct {
+	ctx    context.Context
+	store  Storage
+	id     string
+	offset int64
+	start  int64
+	chunk  io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.chunk == nil {
+			key, err := chunkKey(c.id, c.offset)
+			if err != nil {
+				return 0, err
+			}
+			c.chunk, err = c.store.Open(c.ctx, key)
+			if errors.Is(err, ErrObjectNotFound) {
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			c.start = c.offset
+		}
+
+		n, err := c.chunk.Read(p)
+		c.offset += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+
+		c.chunk.Close()
+		c.chunk = nil
+		if c.offset == c.start {
+			return n, io.EOF
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.chunk != nil {
+		return c.chunk.Close()
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+// memStorage is an in-memory Storage. Like a single S3 PUT, a failed Put
+// leaves no object behind.
+type memStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{objects: make(map[string][]byte)}
+}
+
+func (m *memStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return int64(len(data)), nil
+}
+
+func (m *memStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memStorage) Stat(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.objects[key]
+	if !ok {
+		return 0, ErrObjectNotFound
+	}
+	return int64(len(data)), nil
+}
+
+func (m *memStorage) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memStorage) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestObjectStagingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+	}{
+		{"single chunk", []string{"hello world"}},
+		{"several chunks", []string{"hello ", "chunked ", "world"}},
+		{"one byte chunks", []string{"a", "b", "c", "d"}},
+		{"no chunks", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newMemStorage()
+			staging := NewObjectStaging(store)
+
+			var offset int64
+			for _, chunk := range tt.chunks {
+				written, err := staging.Append(ctx, "upload1", offset, strings.NewReader(chunk))
+				if err != nil {
+					t.Fatalf("Append at %d: %v", offset, err)
+				}
+				if written != int64(len(chunk)) {
+					t.Fatalf("Append at %d kept %d bytes, want %d", offset, written, len(chunk))
+				}
+				offset += written
+			}
+
+			want := strings.Join(tt.chunks, "")
+			if got := readStaged(t, staging, "upload1", false); got != want {
+				t.Errorf("read %q, want %q", got, want)
+			}
+			if got := readStaged(t, staging, "upload1", true); got != want {
+				t.Errorf("read byte by byte %q, want %q", got, want)
+			}
+
+			if err := staging.Remove(ctx, "upload1"); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+			if keys := store.keys(); len(keys) != 0 {
+				t.Errorf("objects left after Remove: %v", keys)
+			}
+		})
+	}
+}
+
+func TestObjectStagingDropsFailedChunk(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStorage()
+	staging := NewObjectStaging(store)
+
+	if _, err := staging.Append(ctx, "upload1", 0, strings.NewReader("first ")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	broken := io.MultiReader(strings.NewReader("half"), iotest.ErrReader(errors.New("connection reset")))
+	written, err := staging.Append(ctx, "upload1", 6, broken)
+	if err == nil || written != 0 {
+		t.Fatalf("Append of broken chunk = %d, %v, want 0 and an error", written, err)
+	}
+	if got := readStaged(t, staging, "upload1", false); got != "first " {
+		t.Errorf("read %q after failed chunk, want %q", got, "first ")
+	}
+
+	// The client resumes from the last acknowledged offset.
+	if _, err := staging.Append(ctx, "upload1", 6, strings.NewReader("second")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if got := readStaged(t, staging, "upload1", false); got != "first second" {
+		t.Errorf("read %q, want %q", got, "first second")
+	}
+}
+
+func TestObjectStagingSkipsEmptyChunk(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStorage()
+	staging := NewObjectStaging(store)
+
+	written, err := staging.Append(ctx, "upload1", 0, strings.NewReader(""))
+	if err != nil || written != 0 {
+		t.Fatalf("Append of empty chunk = %d, %v", written, err)
+	}
+	if keys := store.keys(); len(keys) != 0 {
+		t.Errorf("empty chunk was stored as %v", keys)
+	}
+}
+
+func TestObjectStagingRejectsInvalidID(t *testing.T) {
+	staging := NewObjectStaging(newMemStorage())
+
+	if _, err := staging.Append(context.Background(), "../files/1", 0, strings.NewReader("x")); err == nil {
+		t.Error("Append accepted an upload ID with a path")
+	}
+	if _, err := staging.Open(context.Background(), "a/b"); err == nil {
+		t.Error("Open accepted an upload ID with a path")
+	}
+}
+
+func TestLocalStagingRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	staging, err := NewLocalStaging(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStaging: %v", err)
+	}
+
+	if _, err := staging.Append(ctx, "upload1", 0, strings.NewReader("hello ")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	// Bytes past the acknowledged offset from an interrupted request are
+	// overwritten by the retry.
+	if _, err := staging.Append(ctx, "upload1", 6, strings.NewReader("wor")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if _, err := staging.Append(ctx, "upload1", 6, strings.NewReader("world")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if _, err := staging.Append(ctx, "upload1", 20, strings.NewReader("gap")); err == nil {
+		t.Error("Append past the staged bytes succeeded")
+	}
+
+	if got := readStaged(t, staging, "upload1", false); got != "hello world" {
+		t.Errorf("read %q, want %q", got, "hello world")
+	}
+
+	if err := staging.Remove(ctx, "upload1"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := staging.Open(ctx, "upload1"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Open after Remove = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func readStaged(t *testing.T, staging Staging, id string, byteByByte bool) string {
+	t.Helper()
+
+	staged, err := staging.Open(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer staged.Close()
+
+	var r io.Reader = staged
+	if byteByByte {
+		r = iotest.OneByteReader(staged)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading staged upload: %v", err)
+	}
+	return string(data)
+}
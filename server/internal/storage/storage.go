@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"SecureMessenger/server/internal/config"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage keeps the encrypted blobs referenced by the files table. The server
+// never sees plaintext, so backends only move opaque bytes around.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (int64, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (int64, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by backends that can hand out temporary direct
+// download links, so large files do not have to be proxied by the server.
+type Presigner interface {
+	PresignGet(key, fileName, contentType string) (string, error)
+}
+
+func NewFromConfig() (Storage, error) {
+	backend := config.GetString("STORAGE_BACKEND", "local")
+	switch backend {
+	case "local":
+		return NewLocalStorage(config.GetString("STORAGE_LOCAL_PATH", "./data/files"))
+	case "s3":
+		return NewS3Storage(S3Config{
+			Endpoint:       config.GetString("S3_ENDPOINT", "http://localhost:9000"),
+			PublicEndpoint: config.GetString("S3_PUBLIC_ENDPOINT", ""),
+			Region:         config.GetString("S3_REGION", "us-east-1"),
+			Bucket:         config.GetString("S3_BUCKET", ""),
+			AccessKey:      config.GetString("S3_ACCESS_KEY", ""),
+			SecretKey:      config.GetString("S3_SECRET_KEY", ""),
+			PathStyle:      config.GetBool("S3_PATH_STYLE", true),
+			PartSize:       config.GetInt64("S3_PART_SIZE", 16<<20),
+			PresignExpiry:  config.GetDuration("S3_PRESIGN_EXPIRY", 5*time.Minute),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
@@ -0,0 +1,102 @@
+package utils
+
+import "unicode/utf8"
+
+const (
+	zeroWidthJoiner   = 0x200D
+	variationText     = 0xFE0E
+	variationEmoji    = 0xFE0F
+	combiningKeycap   = 0x20E3
+	blackFlag         = 0x1F3F4
+	cancelTag         = 0xE007F
+	maxEmojiSequences = 10
+)
+
+// pictographic approximates the Extended_Pictographic property of Unicode.
+var pictographic = [][2]rune{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x2199}, {0x21A9, 0x21AA},
+	{0x231A, 0x231B}, {0x2328, 0x2328}, {0x23CF, 0x23CF}, {0x23E9, 0x23F3},
+	{0x23F8, 0x23FA}, {0x24C2, 0x24C2}, {0x25AA, 0x25AB}, {0x25B6, 0x25B6},
+	{0x25C0, 0x25C0}, {0x25FB, 0x25FE}, {0x2600, 0x27BF}, {0x2934, 0x2935},
+	{0x2B05, 0x2B07}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55},
+	{0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3297}, {0x3299, 0x3299},
+	{0x1F000, 0x1F1E5}, {0x1F200, 0x1F3FA}, {0x1F400, 0x1FAFF},
+}
+
+// IsSingleEmoji reports whether value is exactly one emoji: a flag, a keycap,
+// a tag sequence like the England flag, or pictographs with optional
+// presentation selectors and skin tones joined by zero width joiners.
+func IsSingleEmoji(value string) bool {
+	if !utf8.ValidString(value) {
+		return false
+	}
+	runes := []rune(value)
+	if len(runes) == 0 {
+		return false
+	}
+
+	switch {
+	case isRegionalIndicator(runes[0]):
+		return len(runes) == 2 && isRegionalIndicator(runes[1])
+	case isKeycapBase(runes[0]):
+		if len(runes) == 3 && runes[1] == variationEmoji {
+			runes = runes[1:]
+		}
+		return len(runes) == 2 && runes[1] == combiningKeycap
+	case runes[0] == blackFlag && len(runes) > 1 && isTag(runes[1]):
+		for i := 1; i < len(runes)-1; i++ {
+			if !isTag(runes[i]) {
+				return false
+			}
+		}
+		return runes[len(runes)-1] == cancelTag
+	}
+
+	// A ZWJ sequence like a family or a profession with a skin tone.
+	i := 0
+	for sequences := 0; ; sequences++ {
+		if sequences == maxEmojiSequences || i == len(runes) || !isPictographic(runes[i]) {
+			return false
+		}
+		i++
+		if i < len(runes) && (runes[i] == variationEmoji || runes[i] == variationText) {
+			i++
+		}
+		if i < len(runes) && isSkinTone(runes[i]) {
+			i++
+		}
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+		i++
+	}
+}
+
+func isPictographic(r rune) bool {
+	for _, span := range pictographic {
+		if r >= span[0] && r <= span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isSkinTone(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+func isKeycapBase(r rune) bool {
+	return r == '#' || r == '*' || (r >= '0' && r <= '9')
+}
+
+func isTag(r rune) bool {
+	return r >= 0xE0020 && r <= 0xE007E
+}
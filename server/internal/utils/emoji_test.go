@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestIsSingleEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"flag", "\U0001F1E9\U0001F1EA", true},
+		{"zwj family", "\U0001F468\u200D\U0001F469\u200D\U0001F467\u200D\U0001F466", true},
+		{"keycap", "1\uFE0F\u20E3", true},
+		{"skin tone", "\U0001F44D\U0001F3FD", true},
+		{"letter", "a", false},
+		{"two emoji", "\U0001F600\U0001F600", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSingleEmoji(tt.value); got != tt.want {
+				t.Errorf("IsSingleEmoji(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package utils
+
+import "regexp"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func IsValidUUID(value string) bool {
+	return uuidPattern.MatchString(value)
+}
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN family_id VARCHAR(64) NOT NULL,
+    ADD COLUMN used_at TIMESTAMP NULL,
+    ADD COLUMN revoked_at TIMESTAMP NULL;
+
+CREATE UNIQUE INDEX refresh_tokens_token_idx ON refresh_tokens(token);
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens(family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS refresh_tokens_family_id_idx;
+DROP INDEX IF EXISTS refresh_tokens_token_idx;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS used_at,
+    DROP COLUMN IF EXISTS family_id;
+-- +goose StatementEnd
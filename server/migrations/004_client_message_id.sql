@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE messages ADD COLUMN client_message_id UUID NULL;
+
+CREATE UNIQUE INDEX messages_sender_client_message_id_idx ON messages(sender_id, client_message_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS messages_sender_client_message_id_idx;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS client_message_id;
+-- +goose StatementEnd
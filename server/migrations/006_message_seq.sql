@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chats ADD COLUMN last_message_seq BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE messages ADD COLUMN seq BIGINT;
+
+UPDATE messages m
+SET seq = numbered.rn
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY chat_id ORDER BY sent_at, id) AS rn
+    FROM messages
+) numbered
+WHERE m.id = numbered.id;
+
+UPDATE chats c
+SET last_message_seq = COALESCE((SELECT MAX(seq) FROM messages WHERE messages.chat_id = c.id), 0);
+
+ALTER TABLE messages ALTER COLUMN seq SET NOT NULL;
+
+CREATE UNIQUE INDEX messages_chat_id_seq_idx ON messages(chat_id, seq);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS messages_chat_id_seq_idx;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS seq;
+
+ALTER TABLE chats DROP COLUMN IF EXISTS last_message_seq;
+-- +goose StatementEnd
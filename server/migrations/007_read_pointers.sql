@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chat_participants
+    ADD COLUMN last_read_seq BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN last_read_at TIMESTAMP NULL;
+
+-- messages.read_at does not say who read a message, so the only reliable
+-- evidence is what a participant replied to: everything up to their own last
+-- message counts as read.
+UPDATE chat_participants cp
+SET last_read_seq = read.max_seq,
+    last_read_at = read.max_sent_at
+FROM (
+    SELECT cp2.id, MAX(m.seq) AS max_seq, MAX(m.sent_at) AS max_sent_at
+    FROM chat_participants cp2
+    JOIN messages m ON m.chat_id = cp2.chat_id AND m.sender_id = cp2.user_id
+    GROUP BY cp2.id
+) read
+WHERE cp.id = read.id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE chat_participants
+    DROP COLUMN IF EXISTS last_read_at,
+    DROP COLUMN IF EXISTS last_read_seq;
+-- +goose StatementEnd
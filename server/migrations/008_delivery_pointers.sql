@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chat_participants
+    ADD COLUMN last_delivered_seq BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN last_delivered_at TIMESTAMP NULL;
+
+UPDATE chat_participants
+SET last_delivered_seq = last_read_seq,
+    last_delivered_at = last_read_at;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE chat_participants
+    DROP COLUMN IF EXISTS last_delivered_at,
+    DROP COLUMN IF EXISTS last_delivered_seq;
+-- +goose StatementEnd
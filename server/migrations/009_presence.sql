@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN last_seen_at TIMESTAMP NULL,
+    ADD COLUMN last_seen_visibility VARCHAR(10) NOT NULL DEFAULT 'everyone'
+        CHECK (last_seen_visibility IN ('everyone', 'contacts', 'nobody'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS last_seen_visibility,
+    DROP COLUMN IF EXISTS last_seen_at;
+-- +goose StatementEnd
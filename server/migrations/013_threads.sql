@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE messages
+    ADD COLUMN thread_root_id INT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    ADD COLUMN thread_reply_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN thread_last_reply_at TIMESTAMP NULL;
+
+CREATE INDEX idx_messages_thread_root ON messages(thread_root_id, seq) WHERE thread_root_id IS NOT NULL;
+
+CREATE TABLE thread_reads (
+    message_id INT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    last_read_seq BIGINT NOT NULL DEFAULT 0,
+    last_read_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS thread_reads;
+DROP INDEX IF EXISTS idx_messages_thread_root;
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS thread_last_reply_at,
+    DROP COLUMN IF EXISTS thread_reply_count,
+    DROP COLUMN IF EXISTS thread_root_id;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE pinned_messages (
+    chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    message_id INT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    pinned_by INT NOT NULL REFERENCES users(id),
+    pinned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, message_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS pinned_messages;
+-- +goose StatementEnd
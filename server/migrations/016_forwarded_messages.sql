@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE messages
+    ADD COLUMN is_forwarded BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN forwarded_from_message_id INT NULL REFERENCES messages(id) ON DELETE SET NULL,
+    ADD COLUMN forwarded_from_chat_id INT NULL REFERENCES chats(id) ON DELETE SET NULL,
+    ADD COLUMN forwarded_from_sender_id INT NULL REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN forwarded_from_username VARCHAR(50) NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS forwarded_from_username,
+    DROP COLUMN IF EXISTS forwarded_from_sender_id,
+    DROP COLUMN IF EXISTS forwarded_from_chat_id,
+    DROP COLUMN IF EXISTS forwarded_from_message_id,
+    DROP COLUMN IF EXISTS is_forwarded;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files
+    ALTER COLUMN file_url DROP NOT NULL,
+    ADD COLUMN chat_id INT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    ADD COLUMN uploader_id INT NULL REFERENCES users(id),
+    ADD COLUMN storage_key TEXT NULL,
+    ADD COLUMN content_type VARCHAR(255) NOT NULL DEFAULT 'application/octet-stream';
+
+CREATE INDEX idx_files_message_id ON files(message_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_files_message_id;
+ALTER TABLE files
+    DROP COLUMN IF EXISTS content_type,
+    DROP COLUMN IF EXISTS storage_key,
+    DROP COLUMN IF EXISTS uploader_id,
+    DROP COLUMN IF EXISTS chat_id;
+-- +goose StatementEnd
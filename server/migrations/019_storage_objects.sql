@@ -0,0 +1,65 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE storage_objects (
+    id SERIAL PRIMARY KEY,
+    sha256 CHAR(64) NULL UNIQUE,
+    storage_key TEXT NOT NULL UNIQUE,
+    size BIGINT NOT NULL,
+    ref_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    unreferenced_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_storage_objects_unreferenced_at ON storage_objects(unreferenced_at) WHERE ref_count = 0;
+
+ALTER TABLE files ADD COLUMN object_id INT NULL REFERENCES storage_objects(id);
+
+CREATE INDEX idx_files_object_id ON files(object_id);
+
+-- Blobs stored before deduplication have no known hash and are never shared.
+INSERT INTO storage_objects (storage_key, size, ref_count, unreferenced_at)
+SELECT storage_key, size, 1, NULL
+FROM files
+WHERE storage_key IS NOT NULL;
+
+UPDATE files f
+SET object_id = o.id
+FROM storage_objects o
+WHERE o.storage_key = f.storage_key;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- Keeps ref_count in sync for every way a files row can go away, including
+-- cascades from deleted messages and chats.
+CREATE FUNCTION files_object_refs() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.object_id IS NOT NULL THEN
+        UPDATE storage_objects
+        SET ref_count = ref_count + 1, unreferenced_at = NULL
+        WHERE id = NEW.object_id;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.object_id IS NOT NULL THEN
+        UPDATE storage_objects
+        SET ref_count = ref_count - 1,
+            unreferenced_at = CASE WHEN ref_count = 1 THEN NOW() ELSE unreferenced_at END
+        WHERE id = OLD.object_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER files_object_refs
+AFTER INSERT OR DELETE OR UPDATE OF object_id ON files
+FOR EACH ROW EXECUTE FUNCTION files_object_refs();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS files_object_refs ON files;
+DROP FUNCTION IF EXISTS files_object_refs();
+DROP INDEX IF EXISTS idx_files_object_id;
+ALTER TABLE files DROP COLUMN IF EXISTS object_id;
+DROP TABLE IF EXISTS storage_objects;
+-- +goose StatementEnd
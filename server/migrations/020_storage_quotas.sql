@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- NULL limits fall back to the configured defaults.
+CREATE TABLE user_storage_quotas (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    max_bytes BIGINT NULL,
+    max_files INT NULL,
+    updated_by INT NULL REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE chat_storage_quotas (
+    chat_id INT PRIMARY KEY REFERENCES chats(id) ON DELETE CASCADE,
+    max_bytes BIGINT NULL,
+    max_files INT NULL,
+    updated_by INT NULL REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_files_uploader_id ON files(uploader_id);
+CREATE INDEX idx_files_chat_id ON files(chat_id);
+CREATE INDEX idx_uploads_chat_id ON uploads(chat_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_uploads_chat_id;
+DROP INDEX IF EXISTS idx_files_chat_id;
+DROP INDEX IF EXISTS idx_files_uploader_id;
+DROP TABLE IF EXISTS chat_storage_quotas;
+DROP TABLE IF EXISTS user_storage_quotas;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+-- +goose StatementEnd
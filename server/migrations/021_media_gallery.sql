@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files
+    ADD COLUMN media_type VARCHAR(10) NOT NULL DEFAULT 'document',
+    ADD COLUMN thumbnail_file_id INT NULL REFERENCES files(id) ON DELETE SET NULL;
+
+UPDATE files
+SET media_type = CASE
+    WHEN content_type LIKE 'image/%' THEN 'image'
+    WHEN content_type LIKE 'video/%' THEN 'video'
+    WHEN content_type LIKE 'audio/%' THEN 'audio'
+    ELSE 'document'
+END;
+
+ALTER TABLE uploads
+    ADD COLUMN media_type VARCHAR(10) NOT NULL DEFAULT 'document',
+    ADD COLUMN thumbnail_file_id INT NULL REFERENCES files(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_files_chat_media ON files(chat_id, media_type, id DESC) WHERE message_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_files_chat_media;
+ALTER TABLE uploads
+    DROP COLUMN IF EXISTS thumbnail_file_id,
+    DROP COLUMN IF EXISTS media_type;
+ALTER TABLE files
+    DROP COLUMN IF EXISTS thumbnail_file_id,
+    DROP COLUMN IF EXISTS media_type;
+-- +goose StatementEnd
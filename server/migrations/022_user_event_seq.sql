@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN last_event_seq BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN pruned_event_seq BIGINT NOT NULL DEFAULT 0;
+
+-- Existing events keep their IDs as cursors, so clients do not have to resync.
+ALTER TABLE user_events ADD COLUMN seq BIGINT;
+
+UPDATE user_events SET seq = id;
+
+ALTER TABLE user_events ALTER COLUMN seq SET NOT NULL;
+
+UPDATE users u
+SET last_event_seq = stats.last_seq,
+    pruned_event_seq = stats.first_seq - 1
+FROM (
+    SELECT user_id, MIN(seq) AS first_seq, MAX(seq) AS last_seq
+    FROM user_events
+    GROUP BY user_id
+) stats
+WHERE u.id = stats.user_id;
+
+DROP INDEX IF EXISTS user_events_user_id_id_idx;
+
+CREATE UNIQUE INDEX user_events_user_id_seq_idx ON user_events(user_id, seq);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS user_events_user_id_seq_idx;
+
+CREATE INDEX user_events_user_id_id_idx ON user_events(user_id, id);
+
+ALTER TABLE user_events DROP COLUMN IF EXISTS seq;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS pruned_event_seq,
+    DROP COLUMN IF EXISTS last_event_seq;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A PATCH request leases its upload while the chunk streams in instead of
+-- holding a row lock for the whole request.
+ALTER TABLE uploads ADD COLUMN locked_until TIMESTAMP NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE uploads DROP COLUMN IF EXISTS locked_until;
+-- +goose StatementEnd
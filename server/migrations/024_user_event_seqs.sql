@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Event cursors are allocated on every broadcast, so they live in their own
+-- narrow table instead of locking the users rows.
+CREATE TABLE user_event_seqs (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_seq BIGINT NOT NULL DEFAULT 0,
+    pruned_seq BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO user_event_seqs (user_id, last_seq, pruned_seq)
+SELECT id, last_event_seq, pruned_event_seq
+FROM users
+WHERE last_event_seq > 0 OR pruned_event_seq > 0;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS pruned_event_seq,
+    DROP COLUMN IF EXISTS last_event_seq;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN last_event_seq BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN pruned_event_seq BIGINT NOT NULL DEFAULT 0;
+
+UPDATE users u
+SET last_event_seq = s.last_seq,
+    pruned_event_seq = s.pruned_seq
+FROM user_event_seqs s
+WHERE u.id = s.user_id;
+
+DROP TABLE IF EXISTS user_event_seqs;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Blobs are only shared between files of the same uploader, so a matching
+-- hash never tells one user what another has stored.
+ALTER TABLE storage_objects ADD COLUMN owner_id INT NULL REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE storage_objects o
+SET owner_id = (
+    SELECT f.uploader_id FROM files f
+    WHERE f.object_id = o.id
+    ORDER BY f.id
+    LIMIT 1
+);
+
+ALTER TABLE storage_objects DROP CONSTRAINT storage_objects_sha256_key;
+ALTER TABLE storage_objects ADD CONSTRAINT storage_objects_owner_sha256_key UNIQUE (owner_id, sha256);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE storage_objects DROP CONSTRAINT IF EXISTS storage_objects_owner_sha256_key;
+
+-- Only the oldest copy of a blob keeps its hash, the others are no longer
+-- deduplicated.
+UPDATE storage_objects o
+SET sha256 = NULL
+WHERE EXISTS (
+    SELECT 1 FROM storage_objects d
+    WHERE d.sha256 = o.sha256 AND d.id < o.id
+);
+
+ALTER TABLE storage_objects ADD CONSTRAINT storage_objects_sha256_key UNIQUE (sha256);
+ALTER TABLE storage_objects DROP COLUMN IF EXISTS owner_id;
+-- +goose StatementEnd